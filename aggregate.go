@@ -0,0 +1,360 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// aggregate functions, same values as Ranking_Aggregation
+const (
+	AGGREGATE_SUM = iota
+	AGGREGATE_MIN
+	AGGREGATE_MAX
+)
+
+// an aggregation of source sets, the scores of a user are weighted
+// then combined, integer sets take integer weights only.
+// for group aggregations, the users of the single source are combined by
+// their groups, and the users of the result are the groups.
+type Aggregation struct {
+	Sources   []uint64  `msgpack:"sources"`
+	Weights   []float64 `msgpack:"weights"`
+	Mode      int       `msgpack:"mode"`  // AGGREGATE_XXX
+	Intersect bool      `msgpack:"inter"` // only users in all sources
+	Group     bool      `msgpack:"group"` // combine by groups
+}
+
+// combined weighted scores
+type combiner struct {
+	mode  int
+	float bool
+	sum   int64
+	fsum  float64
+	ok    bool // any score combined
+}
+
+func (c *combiner) add(v int64, w float64) {
+	if c.float {
+		f := score_float(v) * w
+		if !c.ok || c.mode == AGGREGATE_MIN && f < c.fsum || c.mode == AGGREGATE_MAX && f > c.fsum {
+			c.fsum = f
+		} else if c.mode == AGGREGATE_SUM {
+			c.fsum += f
+		}
+	} else {
+		v = mul_sat(v, int64(w))
+		if !c.ok || c.mode == AGGREGATE_MIN && v < c.sum || c.mode == AGGREGATE_MAX && v > c.sum {
+			c.sum = v
+		} else if c.mode == AGGREGATE_SUM {
+			c.sum = add_sat(c.sum, v)
+		}
+	}
+	c.ok = true
+}
+
+// a non-finite float result, like +Inf plus -Inf, is out of the result
+func (c *combiner) result() (int64, bool) {
+	if c.float {
+		if math.IsNaN(c.fsum) || math.IsInf(c.fsum, 0) {
+			return 0, false
+		}
+		return float_score(c.fsum), c.ok
+	}
+	return c.sum, c.ok
+}
+
+// aggregated score of a user(or a group), ok is false if it's out of the
+// result, nil sources are taken as empty sets.
+func (a *Aggregation) score(sources []*RankSet, float bool, id int64) (score int64, ok bool) {
+	c := combiner{mode: a.Mode, float: float}
+	if a.Group {
+		if sources[0] != nil {
+			_, scores := sources[0].Members(id, true)
+			for _, v := range scores {
+				c.add(v, a.Weights[0])
+			}
+		}
+		return c.result()
+	}
+
+	for k, rs := range sources {
+		var v int64
+		var has bool
+		if rs != nil {
+			v, has = rs.Score(id)
+		}
+		if !has {
+			if a.Intersect {
+				return 0, false
+			}
+			continue
+		}
+		c.add(v, a.Weights[k])
+	}
+	return c.result()
+}
+
+// aggregated scores of all users(or groups)
+func (a *Aggregation) materialize(sources []*RankSet, float bool) map[int64]int64 {
+	users := make(map[int64]bool)
+	for _, rs := range sources {
+		if rs == nil {
+			continue
+		}
+		ids := rs.Users()
+		if a.Group {
+			ids = rs.Groups()
+		}
+		for _, id := range ids {
+			users[id] = true
+		}
+	}
+
+	scores := make(map[int64]int64)
+	for id := range users {
+		if score, ok := a.score(sources, float, id); ok {
+			scores[id] = score
+		}
+	}
+	return scores
+}
+
+// make the users of dest exactly scores
+func sync_scores(dest *RankSet, scores map[int64]int64) {
+	for _, id := range dest.Users() {
+		if _, ok := scores[id]; !ok {
+			dest.Delete(id)
+		}
+	}
+	for id, score := range scores {
+		dest.Update(id, score, 0, UPDATE_ALWAYS)
+	}
+}
+
+func add_sat(a, b int64) int64 {
+	c := a + b
+	if b > 0 && c < a {
+		return math.MaxInt64
+	} else if b < 0 && c > a {
+		return math.MinInt64
+	}
+	return c
+}
+
+func mul_sat(a, b int64) int64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	c := a * b
+	if c/b != a || b == -1 && a == math.MinInt64 {
+		if (a < 0) != (b < 0) {
+			return math.MinInt64
+		}
+		return math.MaxInt64
+	}
+	return c
+}
+
+// a continuously maintained derived set, sources are observed and the
+// changed users(or groups) are recomputed in background.
+type deriver struct {
+	dest      uint64
+	spec      *Aggregation
+	observers map[uint64]*RankSet // source id => observed set
+	handles   map[uint64]*Observer
+	dirty     map[int64]bool // users to recompute
+	full      bool           // recompute all users
+	filled    chan int32     // count of the set after a full recomputation
+	wake      chan struct{}
+	die       chan struct{}
+	sync.Mutex
+}
+
+func new_deriver(dest uint64, spec *Aggregation) *deriver {
+	d := new(deriver)
+	d.dest = dest
+	d.spec = spec
+	d.observers = make(map[uint64]*RankSet)
+	d.handles = make(map[uint64]*Observer)
+	d.dirty = make(map[int64]bool)
+	d.filled = make(chan int32, 1)
+	d.wake = make(chan struct{}, 1)
+	d.die = make(chan struct{})
+	return d
+}
+
+// observe the current set of a source, nil to stop observing
+func (d *deriver) observe(setid uint64, rs *RankSet) {
+	if old := d.observers[setid]; old != nil {
+		old.Unobserve(d.handles[setid])
+		delete(d.observers, setid)
+		delete(d.handles, setid)
+	}
+	if rs != nil {
+		d.observers[setid] = rs
+		if d.spec.Group { // a changed user marks its group, the set is locked while observing
+			d.handles[setid] = rs.Observe(func(id int64) {
+				if group := rs.G[id]; group != 0 {
+					d.mark(group)
+				}
+			})
+		} else {
+			d.handles[setid] = rs.Observe(d.mark)
+		}
+	}
+}
+
+// mark a changed user
+func (d *deriver) mark(id int64) {
+	d.Lock()
+	d.dirty[id] = true
+	d.Unlock()
+	d.signal()
+}
+
+// mark all users
+func (d *deriver) mark_full() {
+	d.Lock()
+	d.full = true
+	d.Unlock()
+	d.signal()
+}
+
+func (d *deriver) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *deriver) stop() {
+	for setid := range d.observers {
+		d.observe(setid, nil)
+	}
+	close(d.die)
+}
+
+// check if a set depends on target through derivations,
+// called with server lock held.
+func (s *server) depends(setid, target uint64) bool {
+	if setid == target {
+		return true
+	}
+	if d := s.derivers[setid]; d != nil {
+		for _, src := range d.spec.Sources {
+			if s.depends(src, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// start deriving a set, called with server write lock held.
+func (s *server) start_deriver(dest uint64, spec *Aggregation) *deriver {
+	if old := s.derivers[dest]; old != nil {
+		old.stop()
+	}
+	d := new_deriver(dest, spec)
+	for _, src := range spec.Sources {
+		d.observe(src, s.ranks[src])
+	}
+	s.derivers[dest] = d
+	go s.derive(d)
+	return d
+}
+
+// keep derivations and the wal in line with a replaced or removed set,
+// old is the set it replaced, nil if none. called with server write lock
+// held.
+func (s *server) replaced(setid uint64, old *RankSet) {
+	s.wal.replaced(setid, s.ranks[setid])
+	s.follow(setid, old)
+}
+
+// keep derivations and watchers in line with a replaced, rotated or
+// removed set, called with server write lock held.
+func (s *server) follow(setid uint64, old *RankSet) {
+	rs := s.ranks[setid]
+	if old != nil && old != rs {
+		old.Retire()
+	}
+	if d := s.derivers[setid]; d != nil {
+		if rs == nil || rs.Meta.Derived == nil {
+			d.stop()
+			delete(s.derivers, setid)
+		} else {
+			d.mark_full()
+		}
+	}
+
+	for _, d := range s.derivers {
+		for _, src := range d.spec.Sources {
+			if src == setid {
+				d.observe(setid, rs)
+				d.mark_full()
+				break
+			}
+		}
+	}
+}
+
+// background recomputation of a derived set
+func (s *server) derive(d *deriver) {
+	for {
+		select {
+		case <-d.wake:
+		case <-d.die:
+			return
+		}
+
+		d.Lock()
+		dirty, full := d.dirty, d.full
+		d.dirty, d.full = make(map[int64]bool), false
+		d.Unlock()
+
+		// under server lock, so dest is not rotated or replaced meanwhile,
+		// and a stopped deriver never writes.
+		derived := false
+		s.lock_read(func() {
+			if s.derivers[d.dest] != d {
+				return
+			}
+			now := time.Now().Unix()
+			dest := s.ranks[d.dest]
+			if dest == nil || dest.Expired(now) {
+				return
+			}
+			sources := make([]*RankSet, len(d.spec.Sources))
+			for k, src := range d.spec.Sources {
+				if rs := s.ranks[src]; rs != nil && !rs.Expired(now) {
+					sources[k] = rs
+				}
+			}
+
+			if full {
+				sync_scores(dest, d.spec.materialize(sources, dest.Float))
+				select {
+				case d.filled <- dest.Count():
+				default:
+				}
+				log.Debugf("rankset %v derived from %v", d.dest, d.spec.Sources)
+			} else {
+				for id := range dirty {
+					if score, ok := d.spec.score(sources, dest.Float, id); ok {
+						dest.Update(id, score, 0, UPDATE_ALWAYS)
+					} else {
+						dest.Delete(id)
+					}
+				}
+			}
+			derived = true
+		})
+		if derived {
+			s.pending <- d.dest
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	. "rank/proto"
+)
+
+func TestAggregate(t *testing.T) {
+	a := &Aggregation{Sources: []uint64{1, 2}, Weights: []float64{1, 2}, Mode: AGGREGATE_SUM}
+	r1, r2 := NewRankSet(), NewRankSet()
+	r1.Update(1, 10, 0, UPDATE_ALWAYS)
+	r1.Update(2, 20, 0, UPDATE_ALWAYS)
+	r2.Update(2, 5, 0, UPDATE_ALWAYS)
+	r2.Update(3, math.MaxInt64, 0, UPDATE_ALWAYS)
+	sources := []*RankSet{r1, r2}
+
+	scores := a.materialize(sources, false)
+	if len(scores) != 3 || scores[1] != 10 || scores[2] != 30 || scores[3] != math.MaxInt64 {
+		t.Fatal("sum mismatch", scores)
+	}
+
+	a.Mode, a.Intersect = AGGREGATE_MIN, true
+	if scores = a.materialize(sources, false); len(scores) != 1 || scores[2] != 10 {
+		t.Fatal("min intersect mismatch", scores)
+	}
+	a.Mode = AGGREGATE_MAX
+	if scores = a.materialize(sources, false); len(scores) != 1 || scores[2] != 20 {
+		t.Fatal("max intersect mismatch", scores)
+	}
+
+	// a missing source is empty
+	a.Mode, a.Intersect = AGGREGATE_SUM, false
+	if scores = a.materialize([]*RankSet{r1, nil}, false); len(scores) != 2 || scores[2] != 20 {
+		t.Fatal("missing source mismatch", scores)
+	}
+}
+
+func TestAggregateSets(t *testing.T) {
+	s := new_test_server()
+	ctx := context.Background()
+	for i := int32(1); i <= 10; i++ {
+		s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId: i, Score: i})
+		s.RankChange(ctx, &Ranking_Change{SetId: 2, UserId: i + 5, Score: i})
+	}
+
+	// one-shot union
+	c, err := s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 3, SourceIds: []uint64{1, 2}})
+	if err != nil || c.Count != 15 {
+		t.Fatal("one-shot mismatch", c, err)
+	}
+	if _, score := s.ranks[3].Rank(6); score != 7 {
+		t.Fatal("one-shot score mismatch", score)
+	}
+
+	// cycles are rejected
+	if _, err := s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 1, SourceIds: []uint64{1}}); err == nil {
+		t.Fatal("self derivation should be rejected")
+	}
+	// integer sets take integer weights
+	if _, err := s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 4, SourceIds: []uint64{1}, Weights: []float64{0.5}}); err == nil {
+		t.Fatal("fractional weight should be rejected")
+	}
+
+	// continuous intersection follows the sources
+	c, err = s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 4, SourceIds: []uint64{1, 2}, Intersect: true, Continuous: true})
+	if err != nil || c.Count != 5 {
+		t.Fatal("continuous mismatch", c, err)
+	}
+	s.RankChange(ctx, &Ranking_Change{SetId: 2, UserId: 1, Score: 100})
+	s.DeleteUser(ctx, &Ranking_DeleteUserRequest{SetId: 1, UserId: 10})
+	wait := func(cond func() bool) {
+		for k := 0; k < 100 && !cond(); k++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	dest := s.ranks[4]
+	wait(func() bool { return dest.Count() == 5 && func() bool { r, _ := dest.Rank(1); return r == 1 }() })
+	if rank, score := dest.Rank(1); rank != 1 || score != 101 || dest.Count() != 5 {
+		t.Fatal("continuous update mismatch", rank, score, dest.Count())
+	}
+
+	// a deleted source counts as empty
+	s.DeleteSet(ctx, &Ranking_SetId{SetId: 2})
+	wait(func() bool { return dest.Count() == 0 })
+	if dest.Count() != 0 {
+		t.Fatal("source deletion mismatch", dest.Count())
+	}
+
+	// one-shot stops the derivation
+	s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 4, SourceIds: []uint64{1}})
+	if s.derivers[4] != nil || dest.Meta.Derived != nil {
+		t.Fatal("derivation should stop")
+	}
+}
+
+func TestGroupSets(t *testing.T) {
+	s := new_test_server()
+	ctx := context.Background()
+	for i := int32(1); i <= 6; i++ {
+		s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId: i, Score: i})
+	}
+	s.JoinGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{1, 2, 3}, GroupId: 100})
+	s.JoinGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{4, 5, 7}, GroupId: 200}) // 7 has no score yet
+
+	if _, err := s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 2, SourceIds: []uint64{1, 1}, Group: true}); err == nil {
+		t.Fatal("group aggregation takes one source")
+	}
+	c, err := s.AggregateSets(ctx, &Ranking_Aggregate{DestId: 2, SourceIds: []uint64{1}, Group: true, Continuous: true})
+	if err != nil || c.Count != 2 {
+		t.Fatal("group set mismatch", c, err)
+	}
+	dest := s.ranks[2]
+	if _, score := dest.Rank(100); score != 6 {
+		t.Fatal("group score mismatch", score)
+	}
+
+	// score changes, deletions and moves adjust the groups
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId: 7, Score: 100})
+	s.DeleteUser(ctx, &Ranking_DeleteUserRequest{SetId: 1, UserId: 4})
+	s.JoinGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{3}, GroupId: 200})
+	s.LeaveGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{1, 2}})
+	for k := 0; k < 100; k++ {
+		if _, score := dest.Rank(200); score == 108 && dest.Count() == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rank, score := dest.Rank(200); rank != 1 || score != 108 || dest.Count() != 1 {
+		t.Fatal("group update mismatch", rank, score, dest.Count())
+	}
+
+	m, err := s.QueryGroupMembers(ctx, &Ranking_Group{SetId: 1, GroupId: 200})
+	if err != nil || len(m.UserIds) != 4 || m.UserIds[0] != 3 {
+		t.Fatal("members mismatch", m, err)
+	}
+
+	// membership survives a dump
+	bin, _ := s.ranks[1].Marshal()
+	rs := NewRankSet()
+	if err := rs.Unmarshal(bin); err != nil || rs.Group(7) != 200 || rs.Group(1) != 0 {
+		t.Fatal("membership dump mismatch", err)
+	}
+}
@@ -2,6 +2,7 @@ package dos
 
 import (
 	"log"
+	"sort"
 	"strings"
 )
 
@@ -16,20 +17,31 @@ type Node struct {
 	parent *Node
 
 	size  int // the size of this subtree
+	nodes int // the number of nodes in this subtree
 	color bool
 
-	score int32   // the score
-	ids   []int32 // associated ids
+	score int64   // the score
+	tie   int64   // tie-breaker of equal scores, lower is better
+	ids   []int64 // associated ids, in ascending order
 }
 
-func (n *Node) Ids() []int32 {
+func (n *Node) Ids() []int64 {
 	return n.ids
 }
 
-func (n *Node) Score() int32 {
+func (n *Node) Score() int64 {
 	return n.score
 }
 
+func (n *Node) Tie() int64 {
+	return n.tie
+}
+
+// whether (score, tie) ranks before the node
+func (n *Node) _after(score, tie int64) bool {
+	return score > n.score || (score == n.score && tie < n.tie)
+}
+
 //
 type Tree struct {
 	root *Node
@@ -62,7 +74,15 @@ func _nodesize(n *Node) int {
 	return n.size
 }
 
-func lookup_node(n *Node, rank int) (id int32, node *Node) {
+func _nodecount(n *Node) int {
+	if n == nil {
+		return 0
+	}
+
+	return n.nodes
+}
+
+func lookup_node(n *Node, rank int) (id int64, node *Node) {
 	if n == nil {
 		return -1, nil // beware of nil pointer
 	}
@@ -80,19 +100,19 @@ func lookup_node(n *Node, rank int) (id int32, node *Node) {
 	return lookup_node(n.right, rank-end)
 }
 
-func new_node(score int32, id int32, color bool, left, right *Node) *Node {
-	n := Node{score: score, color: color, left: left, right: right, size: 1, ids: []int32{id}}
+func new_node(score int64, tie int64, id int64, color bool, left, right *Node) *Node {
+	n := Node{score: score, tie: tie, color: color, left: left, right: right, size: 1, nodes: 1, ids: []int64{id}}
 	return &n
 }
 
 //--------------------------------------------------------- Lookup by Rank
 // READ-LOCK
-func (t *Tree) Rank(rank int) (id int32, node *Node) {
+func (t *Tree) Rank(rank int) (id int64, node *Node) {
 	return lookup_node(t.root, rank)
 }
 
-func (t *Tree) GetList(a, b int) (ids []int32, scores []int32) {
-	ids, scores = make([]int32, b-a+1), make([]int32, b-a+1)
+func (t *Tree) GetList(a, b int) (ids []int64, scores []int64) {
+	ids, scores = make([]int64, b-a+1), make([]int64, b-a+1)
 	for i := a; i <= b; i++ {
 		id, n := lookup_node(t.root, i)
 		ids[i-a] = id
@@ -102,7 +122,7 @@ func (t *Tree) GetList(a, b int) (ids []int32, scores []int32) {
 }
 
 //--------------------------------------------------------- Lookup by score
-func (t *Tree) _lookup_score(score int32) (rank int, n *Node) {
+func (t *Tree) _lookup_score(score int64, tie int64) (rank int, n *Node) {
 	n = t.root
 
 	if n == nil {
@@ -111,10 +131,10 @@ func (t *Tree) _lookup_score(score int32) (rank int, n *Node) {
 
 	base := 0
 	for n != nil {
-		if score == n.score {
+		if score == n.score && tie == n.tie {
 			rank = base + _nodesize(n.left) + 1 // start rank
 			return rank, n
-		} else if score > n.score {
+		} else if n._after(score, tie) {
 			n = n.left
 		} else {
 			base += _nodesize(n.left) + len(n.ids)
@@ -125,21 +145,65 @@ func (t *Tree) _lookup_score(score int32) (rank int, n *Node) {
 	return -1, nil
 }
 
+//--------------------------------------------------------- Lookup ties
+// READ-LOCK
+// ranks of the node of (score, tie): the rank of its first id, the dense
+// rank counted in distinct (score, tie), and the number of ids in it,
+// -1 if not exists.
+func (t *Tree) GroupRank(score int64, tie int64) (first, dense, count int) {
+	n := t.root
+	base, nodes := 0, 0
+	for n != nil {
+		if score == n.score && tie == n.tie {
+			return base + _nodesize(n.left) + 1, nodes + _nodecount(n.left) + 1, len(n.ids)
+		} else if n._after(score, tie) {
+			n = n.left
+		} else {
+			base += _nodesize(n.left) + len(n.ids)
+			nodes += _nodecount(n.left) + 1
+			n = n.right
+		}
+	}
+	return -1, -1, -1
+}
+
+//--------------------------------------------------------- Lookup by score range
+// count of elements with score higher than the given score,
+// elements with equal score are counted too if inclusive.
+func (t *Tree) _count_above(score int64, inclusive bool) int {
+	n := t.root
+	count := 0
+	for n != nil {
+		if score < n.score || (inclusive && score == n.score) {
+			count += _nodesize(n.left) + len(n.ids)
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return count
+}
+
+// READ-LOCK
+// rank range [A,B] of elements with score in [min,max], A > B if empty
+func (t *Tree) ScoreRange(min, max int64) (A, B int) {
+	return t._count_above(max, false) + 1, t._count_above(min, true)
+}
+
 //---------------------------------------------------------- locate a score & id
 // READ-LOCK
-func (t *Tree) Locate(score int32, id int32) (int, *Node) {
-	rank, node := t._lookup_score(score)
+func (t *Tree) Locate(score int64, tie int64, id int64) (int, *Node) {
+	rank, node := t._lookup_score(score, tie)
 
 	if node == nil { // no such score exists
 		return -1, nil
 	}
 
 	// find the id in all ids
-	for k, v := range node.ids {
-		if v == id {
-			// current rank plus the order in the ids
-			return rank + k, node
-		}
+	k := sort.Search(len(node.ids), func(i int) bool { return node.ids[i] >= id })
+	if k < len(node.ids) && node.ids[k] == id {
+		// current rank plus the order in the ids
+		return rank + k, node
 	}
 
 	return -1, nil
@@ -147,25 +211,28 @@ func (t *Tree) Locate(score int32, id int32) (int, *Node) {
 
 //---------------------------------------------------------- Insert an element
 // WRITE-LOCK
-func (t *Tree) Insert(score int32, id int32) {
-	inserted_node := new_node(score, id, RED, nil, nil)
+func (t *Tree) Insert(score int64, tie int64, id int64) {
+	inserted_node := new_node(score, tie, id, RED, nil, nil)
 	if t.root == nil {
 		t.root = inserted_node
 	} else {
 		n := t.root
 		for {
-			n.size++              // the size of these nodes on the way will be increased by 1
-			if score == n.score { // same score, just append the new id in the []ids then return, no structure changes.
-				n.ids = append(n.ids, id)
+			n.size++                              // the size of these nodes on the way will be increased by 1
+			if score == n.score && tie == n.tie { // same score, just insert the new id in the []ids then return, no structure changes.
+				k := sort.Search(len(n.ids), func(i int) bool { return n.ids[i] > id })
+				n.ids = append(n.ids, 0)
+				copy(n.ids[k+1:], n.ids[k:])
+				n.ids[k] = id
 				return
-			} else if score > n.score { // find higher score in left subtree
+			} else if n._after(score, tie) { // find higher score in left subtree
 				if n.left == nil {
 					n.left = inserted_node
 					break
 				} else {
 					n = n.left
 				}
-			} else if score < n.score { // find lower score in right subtree
+			} else { // find lower score in right subtree
 				if n.right == nil {
 					n.right = inserted_node
 					break
@@ -175,6 +242,9 @@ func (t *Tree) Insert(score int32, id int32) {
 			}
 		}
 		inserted_node.parent = n
+		for ; n != nil; n = n.parent { // a new node on the way
+			n.nodes++
+		}
 	}
 
 	t.insert_case1(inserted_node)
@@ -182,7 +252,7 @@ func (t *Tree) Insert(score int32, id int32) {
 
 //---------------------------------------------------------- Delete an id from a node
 // WRITE-LOCK
-func (t *Tree) Delete(id int32, n *Node) {
+func (t *Tree) Delete(id int64, n *Node) {
 	// just delete the given id in []ids if the id is not the only one in this node
 	if len(n.ids) > 1 {
 		for k, v := range n.ids {
@@ -203,6 +273,7 @@ func (t *Tree) Delete(id int32, n *Node) {
 			pred := maximum_node(n.left)
 			// copy score, id
 			n.score = pred.score
+			n.tie = pred.tie
 			n.ids = pred.ids
 
 			// decrease size by pred.size from pred to N
@@ -216,6 +287,11 @@ func (t *Tree) Delete(id int32, n *Node) {
 			n = pred
 		}
 
+		// one node less from N to the root
+		for tmp := n; tmp != nil; tmp = tmp.parent {
+			tmp.nodes--
+		}
+
 		var child *Node
 		if n.right == nil {
 			child = n.left
@@ -242,6 +318,8 @@ func (t *Tree) Delete(id int32, n *Node) {
 func rotate_left_callback(n, parent *Node) {
 	parent.size = _nodesize(n)
 	n.size = _nodesize(n.left) + _nodesize(n.right) + len(n.ids)
+	parent.nodes = _nodecount(n)
+	n.nodes = _nodecount(n.left) + _nodecount(n.right) + 1
 }
 
 func rotate_right_callback(n, parent *Node) {
@@ -6,11 +6,11 @@ func Benchmark(b *testing.B) {
 	tree := Tree{}
 
 	for i := 0; i < b.N; i++ {
-		tree.Insert(int32(i), int32(i))
+		tree.Insert(int64(i), 0, int64(i))
 	}
 
 	for i := 0; i < b.N; i++ {
-		tree.Locate(int32(i), int32(i))
+		tree.Locate(int64(i), 0, int64(i))
 	}
 }
 
@@ -20,7 +20,7 @@ func TestDos(t *testing.T) {
 	N := 100
 	t.Log("testing tree.Insert()")
 	for i := 0; i < N; i++ {
-		tree.Insert(int32(i), int32(N-i))
+		tree.Insert(int64(i), 0, int64(N-i))
 	}
 	t.Log("Count:", tree.Count())
 
@@ -28,7 +28,7 @@ func TestDos(t *testing.T) {
 
 	t.Log("testing tree.Locate()")
 	for i := 0; i < N; i++ {
-		rank, node := tree.Locate(int32(i), int32(N-i))
+		rank, node := tree.Locate(int64(i), 0, int64(N-i))
 		if node != nil {
 			t.Log("id:", N-i, "score:", i, "rank:", rank, "ids", node.ids)
 		}
@@ -60,10 +60,88 @@ func TestDos(t *testing.T) {
 
 	t.Log("testing tree.Locate()")
 	for i := 0; i < N; i++ {
-		rank, n := tree.Locate(int32(i), int32(20-i))
+		rank, n := tree.Locate(int64(i), 0, int64(20-i))
 		if rank != -1 {
 			t.Logf("score %v, ids %v rank %v \n", n.Score(), n.Ids(), rank)
 		}
 	}
 	t.Log("Count:", tree.Count())
 }
+
+func TestScoreRange(t *testing.T) {
+	tree := Tree{}
+	for i := 0; i < 100; i++ {
+		tree.Insert(int64(i/2), 0, int64(i))
+	}
+
+	A, B := tree.ScoreRange(10, 20)
+	t.Log(A, B)
+	if A != 59 || B != 80 {
+		t.Fatal("score range mismatch", A, B)
+	}
+
+	A, B = tree.ScoreRange(100, 200)
+	if A <= B {
+		t.Fatal("empty score range", A, B)
+	}
+}
+
+func check_nodes(t *testing.T, n *Node) int {
+	if n == nil {
+		return 0
+	}
+	count := check_nodes(t, n.left) + check_nodes(t, n.right) + 1
+	if n.nodes != count {
+		t.Fatal("node count mismatch", n.score, n.nodes, count)
+	}
+	return count
+}
+
+func TestGroupRank(t *testing.T) {
+	tree := Tree{}
+	for i := 0; i < 300; i++ {
+		tree.Insert(int64(i/3), 0, int64(i))
+	}
+	// remove whole nodes and single ids
+	for i := 0; i < 300; i += 7 {
+		rank, n := tree.Locate(int64(i/3), 0, int64(i))
+		if rank == -1 {
+			t.Fatal("id missing", i)
+		}
+		tree.Delete(int64(i), n)
+	}
+	for i := 150; i < 153; i++ {
+		_, n := tree.Locate(int64(i/3), 0, int64(i))
+		if n != nil {
+			tree.Delete(int64(i), n)
+		}
+	}
+	check_nodes(t, tree.Root())
+
+	// compare with a scan of the list
+	ids, scores := tree.GetList(1, tree.Count())
+	dense := 0
+	for k := range ids {
+		if k == 0 || scores[k] != scores[k-1] {
+			dense++
+		}
+		first, d, count := tree.GroupRank(scores[k], 0)
+		j := k
+		for j > 0 && scores[j-1] == scores[k] {
+			j--
+		}
+		c := 0
+		for _, s := range scores {
+			if s == scores[k] {
+				c++
+			}
+		}
+		if first != j+1 || d != dense || count != c {
+			t.Fatal("group rank mismatch", scores[k], first, d, count, j+1, dense, c)
+		}
+	}
+
+	if first, _, _ := tree.GroupRank(50, 0); first != -1 {
+		t.Fatal("removed score should not exist", first)
+	}
+}
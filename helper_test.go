@@ -0,0 +1,18 @@
+package main
+
+// a server with in-memory storage and no wal, shared by all tests
+func new_test_server() *server {
+	s := &server{
+		ranks:    make(map[uint64]*RankSet),
+		history:  make(map[uint64][]*RankSet),
+		derivers: make(map[uint64]*deriver),
+		pending:  make(chan uint64, CHANGES_SIZE),
+		store:    new_memory(),
+		dumped:   make(map[uint64]*RankSet),
+		archived: make(map[uint64]bool),
+		die:      make(chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan error, 1),
+	}
+	return s
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"flag"
 	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	_ "github.com/gonet2/libs/statsd-pprof"
@@ -17,7 +21,33 @@ const (
 	_port = ":50001"
 )
 
+// exit status
+const (
+	EXIT_OK            = 0
+	EXIT_PERSIST_ERROR = 1 // the final checkpoint failed, changes since the last dump are in the wal
+	EXIT_SERVE_ERROR   = 2 // the rpc server stopped by itself
+	EXIT_DRAIN_TIMEOUT = 3 // rpcs were cut off after the drain timeout
+)
+
+var (
+	strict  = flag.Bool("strict", false, "sets must be declared by CreateSet before RankChange")
+	fsync   = flag.String("fsync", "100", "fsync policy of the write-ahead log: always, never, or an interval in milliseconds")
+	storage = flag.String("storage", STORAGE_BOLT, "storage backend: bolt, dir(snapshot files) or memory")
+	restore = flag.String("restore", "", "a snapshot file taken by Snapshot, restored on startup over the stored sets")
+	drain   = flag.Duration("drain", 10*time.Second, "how long to wait for rpcs to finish on SIGTERM before cutting them off")
+)
+
 func main() {
+	flag.Parse()
+	policy, err := parse_fsync(*fsync)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := open_storage(*storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// 监听
 	lis, err := net.Listen("tcp", _port)
 	if err != nil {
@@ -28,9 +58,52 @@ func main() {
 
 	// 注册服务
 	s := grpc.NewServer()
-	ins := &server{}
+	ins := &server{strict: *strict, fsync: policy, store: store, snapfile: *restore}
 	ins.init()
 	pb.RegisterRankingServiceServer(s, ins)
 	// 开始服务
-	s.Serve(lis)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(lis)
+	}()
+
+	// 停止服务, 新的调用被拒绝, 等待进行中的调用结束后持久化
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	status := EXIT_OK
+	select {
+	case nr := <-sig:
+		log.Info(nr)
+	case err := <-served:
+		log.Error(err)
+		status = EXIT_SERVE_ERROR
+	}
+	ins.end_streams()
+	if !graceful_stop(s, *drain) {
+		log.Warningf("rpcs not finished in %v, cut off", *drain)
+		status = EXIT_DRAIN_TIMEOUT
+	}
+	if err := ins.shutdown(); err != nil {
+		log.Error(err)
+		status = EXIT_PERSIST_ERROR
+	}
+	os.Exit(status)
+}
+
+// stop accepting rpcs and wait for the running ones, streams still open
+// after the timeout are closed, returns false if so.
+func graceful_stop(s *grpc.Server, timeout time.Duration) bool {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return true
+	case <-time.After(timeout):
+		s.Stop()
+		<-stopped
+		return false
+	}
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// periods of sets, same values as Ranking_Period
+const (
+	PERIOD_NONE    = iota // never rotates
+	PERIOD_DAILY          // rotates at 00:00
+	PERIOD_WEEKLY         // rotates at monday 00:00
+	PERIOD_MONTHLY        // rotates at 00:00 of the 1st day
+)
+
+// start of the period containing t
+func period_start(period int, loc *time.Location, t time.Time) time.Time {
+	t = t.In(loc)
+	y, m, d := t.Date()
+	switch period {
+	case PERIOD_DAILY:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case PERIOD_WEEKLY:
+		wd := (int(t.Weekday()) + 6) % 7 // days since monday
+		return time.Date(y, m, d-wd, 0, 0, 0, 0, loc)
+	case PERIOD_MONTHLY:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	}
+	return t
+}
+
+// start of the period k periods before the one starting at start
+func period_back(period int, start time.Time, k int) time.Time {
+	switch period {
+	case PERIOD_DAILY:
+		return start.AddDate(0, 0, -k)
+	case PERIOD_WEEKLY:
+		return start.AddDate(0, 0, -7*k)
+	case PERIOD_MONTHLY:
+		return start.AddDate(0, -k, 0)
+	}
+	return start
+}
+
+// location of period boundaries, UTC if not loadable
+func (m *SetMeta) location() *time.Location {
+	loc, err := time.LoadLocation(m.Timezone)
+	if err != nil {
+		log.Error(err)
+		return time.UTC
+	}
+	return loc
+}
+
+// db key of a past generation
+func history_key(setid uint64, start int64) []byte {
+	return []byte(fmt.Sprintf("%v/%v", setid, start))
+}
+
+// whether a periodic set has passed the end of its period
+func (r *RankSet) due(now int64) bool {
+	end := atomic.LoadInt64(&r.end)
+	if end == 0 {
+		r.RLock()
+		period, start, loc := r.Meta.Period, r.Meta.Start, r.Meta.location()
+		r.RUnlock()
+		end = math.MaxInt64
+		if period != PERIOD_NONE {
+			end = period_back(period, time.Unix(start, 0).In(loc), -1).Unix()
+		}
+		atomic.StoreInt64(&r.end, end)
+	}
+	return now >= end
+}
+
+// get the rankset of a generation, 0 for the current one, past generations
+// are counted in periods back from the current one.
+func (s *server) generation(setid uint64, gen int32) (rs *RankSet) {
+	if gen < 0 {
+		return nil
+	}
+	if rs = s.get(setid); rs == nil || gen == 0 {
+		return
+	}
+
+	// locate the generation by its start
+	meta := &rs.Meta
+	rs = nil
+	if meta.Period == PERIOD_NONE {
+		return
+	}
+	start := period_back(meta.Period, time.Unix(meta.Start, 0).In(meta.location()), int(gen)).Unix()
+	s.lock_read(func() {
+		for _, h := range s.history[setid] {
+			if h.Meta.Start == start {
+				rs = h
+				return
+			}
+		}
+	})
+	return
+}
+
+// rotate periodic sets past their period boundaries, sets are rotated when
+// resolved too, this catches the idle ones.
+func (s *server) rotate(now time.Time) {
+	s.lock_write(func() {
+		for id, rs := range s.ranks {
+			if rs.due(now.Unix()) {
+				s.rotate_set(id, rs, now.Unix())
+			}
+		}
+	})
+}
+
+// rotate a set into the generation of now, the set is archived as a past
+// generation. called with server write lock held, so no change is in
+// flight on the archived set.
+func (s *server) rotate_set(setid uint64, rs *RankSet, now int64) *RankSet {
+	start := period_start(rs.Meta.Period, rs.Meta.location(), time.Unix(now, 0))
+
+	// the next generation inherits all options
+	next := NewRankSet()
+	rs.RLock()
+	next.Float, next.Order, next.Meta = rs.Float, rs.Order, rs.Meta
+	for id, group := range rs.G { // groups outlive generations
+		next.set_group(id, group)
+	}
+	rs.RUnlock()
+	next.Meta.Start = start.Unix()
+
+	expired := s.archive(setid, rs, next)
+	s.ranks[setid] = next
+	s.wal.rotated(setid, next)
+	s.follow(setid, rs)
+	log.Infof("rankset %v rotated into %v, %v generations expired", setid, start, expired)
+	return next
+}
+
+// move a set into past generations ahead of its next generation, those
+// beyond Keep are dropped, returns how many. storage follows on dump.
+func (s *server) archive(setid uint64, rs *RankSet, next *RankSet) (expired int) {
+	meta := &next.Meta
+	oldest := period_back(meta.Period, time.Unix(meta.Start, 0).In(meta.location()), int(meta.Keep)).Unix()
+	var kept []*RankSet
+	for _, h := range append([]*RankSet{rs}, s.history[setid]...) {
+		if h.Meta.Start >= oldest {
+			kept = append(kept, h)
+		} else {
+			expired++
+		}
+	}
+	s.history[setid] = kept
+	s.archived[setid] = true
+	return
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	. "rank/proto"
+)
+
+func TestPeriodStart(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2016, 10, 19, 3, 0, 0, 0, time.UTC) // wednesday 11:00 in UTC+8
+
+	if s := period_start(PERIOD_DAILY, loc, now); !s.Equal(time.Date(2016, 10, 19, 0, 0, 0, 0, loc)) {
+		t.Fatal("daily start mismatch", s)
+	}
+	if s := period_start(PERIOD_WEEKLY, loc, now); !s.Equal(time.Date(2016, 10, 17, 0, 0, 0, 0, loc)) {
+		t.Fatal("weekly start mismatch", s)
+	}
+	if s := period_start(PERIOD_MONTHLY, loc, now); !s.Equal(time.Date(2016, 10, 1, 0, 0, 0, 0, loc)) {
+		t.Fatal("monthly start mismatch", s)
+	}
+
+	// the day boundary in UTC+8 is 16:00 UTC
+	if s := period_start(PERIOD_DAILY, loc, now.Add(13*time.Hour)); !s.Equal(time.Date(2016, 10, 20, 0, 0, 0, 0, loc)) {
+		t.Fatal("daily boundary mismatch", s)
+	}
+
+	start := time.Date(2016, 3, 1, 0, 0, 0, 0, loc)
+	if s := period_back(PERIOD_MONTHLY, start, 2); !s.Equal(time.Date(2016, 1, 1, 0, 0, 0, 0, loc)) {
+		t.Fatal("monthly back mismatch", s)
+	}
+	if s := period_back(PERIOD_WEEKLY, start, 1); !s.Equal(time.Date(2016, 2, 23, 0, 0, 0, 0, loc)) {
+		t.Fatal("weekly back mismatch", s)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s := new_test_server()
+	store := s.store.(*memory_storage)
+	day := time.Now().UTC().AddDate(0, 0, -3) // the last generation is the current one
+	rs := NewRankSet()
+	rs.Meta = SetMeta{Period: PERIOD_DAILY, Keep: 2, Start: period_start(PERIOD_DAILY, time.UTC, day).Unix()}
+	s.ranks[1] = rs
+
+	// one generation per day, each with its day as the score of user 1
+	for d := 0; d < 4; d++ {
+		now := day.AddDate(0, 0, d)
+		old := s.ranks[1]
+		s.rotate(now)
+		if d > 0 && (s.ranks[1] == old || !s.archived[1]) {
+			t.Fatal("set should be rotated", d)
+		}
+		s.ranks[1].Update(1, int64(d), 0, UPDATE_ALWAYS)
+	}
+	if err := s.dump(make(map[uint64]bool)); err != nil {
+		t.Fatal(err)
+	}
+
+	// generations 0..2 are queryable, 3 is expired
+	for gen := int32(0); gen <= 2; gen++ {
+		rs := s.generation(1, gen)
+		if rs == nil {
+			t.Fatal("generation missing", gen)
+		}
+		if _, score := rs.Rank(1); score != int64(3-gen) {
+			t.Fatal("generation score mismatch", gen, score)
+		}
+	}
+	if s.generation(1, 3) != nil || s.generation(1, -1) != nil {
+		t.Fatal("expired generation should be gone")
+	}
+
+	// only kept generations are in storage
+	if count := len(store.history[1]); count != 2 {
+		t.Fatal("history in storage mismatch", count)
+	}
+}
+
+func TestLazyRotate(t *testing.T) {
+	s := new_test_server()
+	ctx := context.Background()
+	now := time.Now()
+	s.CreateSet(ctx, &Ranking_CreateSet{SetId: 1, Period: Ranking_DAILY, Keep: 1})
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 1, Score64: 1})
+
+	// the period ended a day ago
+	old := s.ranks[1]
+	old.Meta.Start = period_start(PERIOD_DAILY, time.UTC, now.AddDate(0, 0, -1)).Unix()
+	old.end = 0
+	w := old.Watch(0)
+
+	// the change lands in the new generation
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, Score64: 2})
+	rs := s.ranks[1]
+	if rs == old || rs.Count() != 1 || old.Count() != 1 || rs.Meta.Start != period_start(PERIOD_DAILY, time.UTC, now).Unix() {
+		t.Fatal("set should be rotated before the change", rs.Count(), old.Count())
+	}
+	if s.generation(1, 1) != old {
+		t.Fatal("archived generation mismatch")
+	}
+	select {
+	case <-w.Done:
+	default:
+		t.Fatal("watchers of the archived set should be told")
+	}
+
+	// saved on dump
+	if err := s.dump(make(map[uint64]bool)); err != nil {
+		t.Fatal(err)
+	}
+	if count := len(s.store.(*memory_storage).history[1]); count != 1 {
+		t.Fatal("history in storage mismatch", count)
+	}
+}
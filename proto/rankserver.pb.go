@@ -33,6 +33,135 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto1.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type Ranking_Mode int32
+
+const (
+	Ranking_ALWAYS  Ranking_Mode = 0
+	Ranking_GREATER Ranking_Mode = 1
+	Ranking_LESS    Ranking_Mode = 2
+	Ranking_NX      Ranking_Mode = 3
+	Ranking_XX      Ranking_Mode = 4
+)
+
+var Ranking_Mode_name = map[int32]string{
+	0: "ALWAYS",
+	1: "GREATER",
+	2: "LESS",
+	3: "NX",
+	4: "XX",
+}
+var Ranking_Mode_value = map[string]int32{
+	"ALWAYS":  0,
+	"GREATER": 1,
+	"LESS":    2,
+	"NX":      3,
+	"XX":      4,
+}
+
+func (x Ranking_Mode) String() string {
+	return proto1.EnumName(Ranking_Mode_name, int32(x))
+}
+func (Ranking_Mode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 0} }
+
+type Ranking_Order int32
+
+const (
+	Ranking_DESC Ranking_Order = 0
+	Ranking_ASC  Ranking_Order = 1
+)
+
+var Ranking_Order_name = map[int32]string{
+	0: "DESC",
+	1: "ASC",
+}
+var Ranking_Order_value = map[string]int32{
+	"DESC": 0,
+	"ASC":  1,
+}
+
+func (x Ranking_Order) String() string {
+	return proto1.EnumName(Ranking_Order_name, int32(x))
+}
+func (Ranking_Order) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 1} }
+
+type Ranking_Period int32
+
+const (
+	Ranking_NONE    Ranking_Period = 0
+	Ranking_DAILY   Ranking_Period = 1
+	Ranking_WEEKLY  Ranking_Period = 2
+	Ranking_MONTHLY Ranking_Period = 3
+)
+
+var Ranking_Period_name = map[int32]string{
+	0: "NONE",
+	1: "DAILY",
+	2: "WEEKLY",
+	3: "MONTHLY",
+}
+var Ranking_Period_value = map[string]int32{
+	"NONE":    0,
+	"DAILY":   1,
+	"WEEKLY":  2,
+	"MONTHLY": 3,
+}
+
+func (x Ranking_Period) String() string {
+	return proto1.EnumName(Ranking_Period_name, int32(x))
+}
+func (Ranking_Period) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 2} }
+
+type Ranking_Aggregation int32
+
+const (
+	Ranking_SUM Ranking_Aggregation = 0
+	Ranking_MIN Ranking_Aggregation = 1
+	Ranking_MAX Ranking_Aggregation = 2
+)
+
+var Ranking_Aggregation_name = map[int32]string{
+	0: "SUM",
+	1: "MIN",
+	2: "MAX",
+}
+var Ranking_Aggregation_value = map[string]int32{
+	"SUM": 0,
+	"MIN": 1,
+	"MAX": 2,
+}
+
+func (x Ranking_Aggregation) String() string {
+	return proto1.EnumName(Ranking_Aggregation_name, int32(x))
+}
+func (Ranking_Aggregation) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 3} }
+
+type Ranking_Ties int32
+
+const (
+	Ranking_ORDINAL     Ranking_Ties = 0
+	Ranking_COMPETITION Ranking_Ties = 1
+	Ranking_DENSE       Ranking_Ties = 2
+	Ranking_FRACTIONAL  Ranking_Ties = 3
+)
+
+var Ranking_Ties_name = map[int32]string{
+	0: "ORDINAL",
+	1: "COMPETITION",
+	2: "DENSE",
+	3: "FRACTIONAL",
+}
+var Ranking_Ties_value = map[string]int32{
+	"ORDINAL":     0,
+	"COMPETITION": 1,
+	"DENSE":       2,
+	"FRACTIONAL":  3,
+}
+
+func (x Ranking_Ties) String() string {
+	return proto1.EnumName(Ranking_Ties_name, int32(x))
+}
+func (Ranking_Ties) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 4} }
+
 type Ranking struct {
 }
 
@@ -58,78 +187,500 @@ func (m *Ranking_SetId) String() string            { return proto1.CompactTextSt
 func (*Ranking_SetId) ProtoMessage()               {}
 func (*Ranking_SetId) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 1} }
 
+type Ranking_CreateSet struct {
+	SetId    uint64            `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	Order    Ranking_Order     `protobuf:"varint,2,opt,name=Order,enum=proto.Ranking_Order" json:"Order,omitempty"`
+	Float    bool              `protobuf:"varint,3,opt,name=Float" json:"Float,omitempty"`
+	Name     string            `protobuf:"bytes,4,opt,name=Name" json:"Name,omitempty"`
+	Owner    string            `protobuf:"bytes,5,opt,name=Owner" json:"Owner,omitempty"`
+	MaxSize  int32             `protobuf:"varint,6,opt,name=MaxSize" json:"MaxSize,omitempty"`
+	TTL      int64             `protobuf:"varint,7,opt,name=TTL" json:"TTL,omitempty"`
+	Labels   map[string]string `protobuf:"bytes,8,rep,name=Labels" json:"Labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Period   Ranking_Period    `protobuf:"varint,9,opt,name=Period,enum=proto.Ranking_Period" json:"Period,omitempty"`
+	Timezone string            `protobuf:"bytes,10,opt,name=Timezone" json:"Timezone,omitempty"`
+	Keep     int32             `protobuf:"varint,11,opt,name=Keep" json:"Keep,omitempty"`
+	ExpireAt int64             `protobuf:"varint,12,opt,name=ExpireAt" json:"ExpireAt,omitempty"`
+	IdleTTL  int64             `protobuf:"varint,13,opt,name=IdleTTL" json:"IdleTTL,omitempty"`
+}
+
+func (m *Ranking_CreateSet) Reset()                    { *m = Ranking_CreateSet{} }
+func (m *Ranking_CreateSet) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_CreateSet) ProtoMessage()               {}
+func (*Ranking_CreateSet) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 2} }
+
+func (m *Ranking_CreateSet) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+type Ranking_SetExpiry struct {
+	SetId    uint64 `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	ExpireAt int64  `protobuf:"varint,2,opt,name=ExpireAt" json:"ExpireAt,omitempty"`
+}
+
+func (m *Ranking_SetExpiry) Reset()                    { *m = Ranking_SetExpiry{} }
+func (m *Ranking_SetExpiry) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_SetExpiry) ProtoMessage()               {}
+func (*Ranking_SetExpiry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 3} }
+
+type Ranking_SetInfo struct {
+	SetId       uint64            `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	Order       Ranking_Order     `protobuf:"varint,2,opt,name=Order,enum=proto.Ranking_Order" json:"Order,omitempty"`
+	Float       bool              `protobuf:"varint,3,opt,name=Float" json:"Float,omitempty"`
+	Name        string            `protobuf:"bytes,4,opt,name=Name" json:"Name,omitempty"`
+	Owner       string            `protobuf:"bytes,5,opt,name=Owner" json:"Owner,omitempty"`
+	MaxSize     int32             `protobuf:"varint,6,opt,name=MaxSize" json:"MaxSize,omitempty"`
+	TTL         int64             `protobuf:"varint,7,opt,name=TTL" json:"TTL,omitempty"`
+	Labels      map[string]string `protobuf:"bytes,8,rep,name=Labels" json:"Labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	CreatedAt   int64             `protobuf:"varint,9,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	Count       int32             `protobuf:"varint,10,opt,name=Count" json:"Count,omitempty"`
+	Period      Ranking_Period    `protobuf:"varint,11,opt,name=Period,enum=proto.Ranking_Period" json:"Period,omitempty"`
+	Timezone    string            `protobuf:"bytes,12,opt,name=Timezone" json:"Timezone,omitempty"`
+	Keep        int32             `protobuf:"varint,13,opt,name=Keep" json:"Keep,omitempty"`
+	PeriodStart int64             `protobuf:"varint,14,opt,name=PeriodStart" json:"PeriodStart,omitempty"`
+	ExpireAt    int64             `protobuf:"varint,15,opt,name=ExpireAt" json:"ExpireAt,omitempty"`
+	IdleTTL     int64             `protobuf:"varint,16,opt,name=IdleTTL" json:"IdleTTL,omitempty"`
+	Derived     bool              `protobuf:"varint,17,opt,name=Derived" json:"Derived,omitempty"`
+}
+
+func (m *Ranking_SetInfo) Reset()                    { *m = Ranking_SetInfo{} }
+func (m *Ranking_SetInfo) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_SetInfo) ProtoMessage()               {}
+func (*Ranking_SetInfo) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 4} }
+
+func (m *Ranking_SetInfo) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+type Ranking_ListSets struct {
+	Owner  string            `protobuf:"bytes,1,opt,name=Owner" json:"Owner,omitempty"`
+	Labels map[string]string `protobuf:"bytes,2,rep,name=Labels" json:"Labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Ranking_ListSets) Reset()                    { *m = Ranking_ListSets{} }
+func (m *Ranking_ListSets) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ListSets) ProtoMessage()               {}
+func (*Ranking_ListSets) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 5} }
+
+func (m *Ranking_ListSets) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+type Ranking_SetInfos struct {
+	Sets []*Ranking_SetInfo `protobuf:"bytes,1,rep,name=Sets" json:"Sets,omitempty"`
+}
+
+func (m *Ranking_SetInfos) Reset()                    { *m = Ranking_SetInfos{} }
+func (m *Ranking_SetInfos) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_SetInfos) ProtoMessage()               {}
+func (*Ranking_SetInfos) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 6} }
+
+func (m *Ranking_SetInfos) GetSets() []*Ranking_SetInfo {
+	if m != nil {
+		return m.Sets
+	}
+	return nil
+}
+
 type Ranking_DeleteUserRequest struct {
-	SetId  uint64 `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
-	UserId int32  `protobuf:"varint,2,opt,name=UserId" json:"UserId,omitempty"`
+	SetId    uint64 `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	UserId   int32  `protobuf:"varint,2,opt,name=UserId" json:"UserId,omitempty"`
+	UserId64 int64  `protobuf:"varint,3,opt,name=UserId64" json:"UserId64,omitempty"`
 }
 
 func (m *Ranking_DeleteUserRequest) Reset()                    { *m = Ranking_DeleteUserRequest{} }
 func (m *Ranking_DeleteUserRequest) String() string            { return proto1.CompactTextString(m) }
 func (*Ranking_DeleteUserRequest) ProtoMessage()               {}
-func (*Ranking_DeleteUserRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 2} }
+func (*Ranking_DeleteUserRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 7} }
 
 type Ranking_Change struct {
-	UserId int32  `protobuf:"varint,1,opt,name=UserId" json:"UserId,omitempty"`
-	Score  int32  `protobuf:"varint,2,opt,name=Score" json:"Score,omitempty"`
-	SetId  uint64 `protobuf:"varint,3,opt,name=SetId" json:"SetId,omitempty"`
+	UserId     int32         `protobuf:"varint,1,opt,name=UserId" json:"UserId,omitempty"`
+	Score      int32         `protobuf:"varint,2,opt,name=Score" json:"Score,omitempty"`
+	SetId      uint64        `protobuf:"varint,3,opt,name=SetId" json:"SetId,omitempty"`
+	Mode       Ranking_Mode  `protobuf:"varint,4,opt,name=Mode,enum=proto.Ranking_Mode" json:"Mode,omitempty"`
+	Seq        uint64        `protobuf:"varint,5,opt,name=Seq" json:"Seq,omitempty"`
+	UserId64   int64         `protobuf:"varint,6,opt,name=UserId64" json:"UserId64,omitempty"`
+	Score64    int64         `protobuf:"varint,7,opt,name=Score64" json:"Score64,omitempty"`
+	Tie        int64         `protobuf:"varint,8,opt,name=Tie" json:"Tie,omitempty"`
+	ScoreFloat float64       `protobuf:"fixed64,9,opt,name=ScoreFloat" json:"ScoreFloat,omitempty"`
+	Float      bool          `protobuf:"varint,10,opt,name=Float" json:"Float,omitempty"`
+	Order      Ranking_Order `protobuf:"varint,11,opt,name=Order,enum=proto.Ranking_Order" json:"Order,omitempty"`
 }
 
 func (m *Ranking_Change) Reset()                    { *m = Ranking_Change{} }
 func (m *Ranking_Change) String() string            { return proto1.CompactTextString(m) }
 func (*Ranking_Change) ProtoMessage()               {}
-func (*Ranking_Change) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 3} }
+func (*Ranking_Change) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 8} }
+
+type Ranking_ChangeResult struct {
+	Changed bool `protobuf:"varint,1,opt,name=Changed" json:"Changed,omitempty"`
+	OnBoard bool `protobuf:"varint,2,opt,name=OnBoard" json:"OnBoard,omitempty"`
+}
+
+func (m *Ranking_ChangeResult) Reset()                    { *m = Ranking_ChangeResult{} }
+func (m *Ranking_ChangeResult) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ChangeResult) ProtoMessage()               {}
+func (*Ranking_ChangeResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 9} }
+
+type Ranking_Ack struct {
+	Seq     uint64 `protobuf:"varint,1,opt,name=Seq" json:"Seq,omitempty"`
+	Applied int64  `protobuf:"varint,2,opt,name=Applied" json:"Applied,omitempty"`
+	Changed int64  `protobuf:"varint,3,opt,name=Changed" json:"Changed,omitempty"`
+}
+
+func (m *Ranking_Ack) Reset()                    { *m = Ranking_Ack{} }
+func (m *Ranking_Ack) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Ack) ProtoMessage()               {}
+func (*Ranking_Ack) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 10} }
+
+type Ranking_ChangeBatch struct {
+	Changes []*Ranking_Change `protobuf:"bytes,1,rep,name=Changes" json:"Changes,omitempty"`
+}
+
+func (m *Ranking_ChangeBatch) Reset()                    { *m = Ranking_ChangeBatch{} }
+func (m *Ranking_ChangeBatch) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ChangeBatch) ProtoMessage()               {}
+func (*Ranking_ChangeBatch) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 11} }
+
+func (m *Ranking_ChangeBatch) GetChanges() []*Ranking_Change {
+	if m != nil {
+		return m.Changes
+	}
+	return nil
+}
+
+type Ranking_ChangeBatchResult struct {
+	Changed []bool  `protobuf:"varint,1,rep,packed,name=Changed" json:"Changed,omitempty"`
+	Ranks   []int32 `protobuf:"varint,2,rep,packed,name=Ranks" json:"Ranks,omitempty"`
+}
+
+func (m *Ranking_ChangeBatchResult) Reset()                    { *m = Ranking_ChangeBatchResult{} }
+func (m *Ranking_ChangeBatchResult) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ChangeBatchResult) ProtoMessage()               {}
+func (*Ranking_ChangeBatchResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 12} }
+
+type Ranking_Increment struct {
+	UserId     int32         `protobuf:"varint,1,opt,name=UserId" json:"UserId,omitempty"`
+	Delta      int32         `protobuf:"varint,2,opt,name=Delta" json:"Delta,omitempty"`
+	SetId      uint64        `protobuf:"varint,3,opt,name=SetId" json:"SetId,omitempty"`
+	UserId64   int64         `protobuf:"varint,4,opt,name=UserId64" json:"UserId64,omitempty"`
+	Delta64    int64         `protobuf:"varint,5,opt,name=Delta64" json:"Delta64,omitempty"`
+	DeltaFloat float64       `protobuf:"fixed64,6,opt,name=DeltaFloat" json:"DeltaFloat,omitempty"`
+	Float      bool          `protobuf:"varint,7,opt,name=Float" json:"Float,omitempty"`
+	Order      Ranking_Order `protobuf:"varint,8,opt,name=Order,enum=proto.Ranking_Order" json:"Order,omitempty"`
+}
+
+func (m *Ranking_Increment) Reset()                    { *m = Ranking_Increment{} }
+func (m *Ranking_Increment) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Increment) ProtoMessage()               {}
+func (*Ranking_Increment) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 13} }
+
+type Ranking_UserRank struct {
+	Rank       int32   `protobuf:"varint,1,opt,name=Rank" json:"Rank,omitempty"`
+	Score      int32   `protobuf:"varint,2,opt,name=Score" json:"Score,omitempty"`
+	Score64    int64   `protobuf:"varint,3,opt,name=Score64" json:"Score64,omitempty"`
+	ScoreFloat float64 `protobuf:"fixed64,4,opt,name=ScoreFloat" json:"ScoreFloat,omitempty"`
+}
+
+func (m *Ranking_UserRank) Reset()                    { *m = Ranking_UserRank{} }
+func (m *Ranking_UserRank) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_UserRank) ProtoMessage()               {}
+func (*Ranking_UserRank) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 14} }
 
 type Ranking_Range struct {
-	A     int32  `protobuf:"varint,1,opt,name=A" json:"A,omitempty"`
-	B     int32  `protobuf:"varint,2,opt,name=B" json:"B,omitempty"`
-	SetId uint64 `protobuf:"varint,3,opt,name=SetId" json:"SetId,omitempty"`
+	A          int32        `protobuf:"varint,1,opt,name=A" json:"A,omitempty"`
+	B          int32        `protobuf:"varint,2,opt,name=B" json:"B,omitempty"`
+	SetId      uint64       `protobuf:"varint,3,opt,name=SetId" json:"SetId,omitempty"`
+	Generation int32        `protobuf:"varint,4,opt,name=Generation" json:"Generation,omitempty"`
+	Ties       Ranking_Ties `protobuf:"varint,5,opt,name=Ties,enum=proto.Ranking_Ties" json:"Ties,omitempty"`
 }
 
 func (m *Ranking_Range) Reset()                    { *m = Ranking_Range{} }
 func (m *Ranking_Range) String() string            { return proto1.CompactTextString(m) }
 func (*Ranking_Range) ProtoMessage()               {}
-func (*Ranking_Range) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 4} }
+func (*Ranking_Range) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 15} }
 
 type Ranking_RankList struct {
-	UserIds []int32 `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
-	Scores  []int32 `protobuf:"varint,2,rep,packed,name=Scores" json:"Scores,omitempty"`
+	UserIds         []int32   `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	Scores          []int32   `protobuf:"varint,2,rep,packed,name=Scores" json:"Scores,omitempty"`
+	UserIds64       []int64   `protobuf:"varint,3,rep,packed,name=UserIds64" json:"UserIds64,omitempty"`
+	Scores64        []int64   `protobuf:"varint,4,rep,packed,name=Scores64" json:"Scores64,omitempty"`
+	ScoresFloat     []float64 `protobuf:"fixed64,5,rep,packed,name=ScoresFloat" json:"ScoresFloat,omitempty"`
+	Ranks           []int32   `protobuf:"varint,6,rep,packed,name=Ranks" json:"Ranks,omitempty"`
+	RanksFractional []float64 `protobuf:"fixed64,7,rep,packed,name=RanksFractional" json:"RanksFractional,omitempty"`
 }
 
 func (m *Ranking_RankList) Reset()                    { *m = Ranking_RankList{} }
 func (m *Ranking_RankList) String() string            { return proto1.CompactTextString(m) }
 func (*Ranking_RankList) ProtoMessage()               {}
-func (*Ranking_RankList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 5} }
+func (*Ranking_RankList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 16} }
 
 type Ranking_Users struct {
-	UserIds []int32 `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
-	SetId   uint64  `protobuf:"varint,2,opt,name=SetId" json:"SetId,omitempty"`
+	UserIds    []int32      `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	SetId      uint64       `protobuf:"varint,2,opt,name=SetId" json:"SetId,omitempty"`
+	UserIds64  []int64      `protobuf:"varint,3,rep,packed,name=UserIds64" json:"UserIds64,omitempty"`
+	Generation int32        `protobuf:"varint,4,opt,name=Generation" json:"Generation,omitempty"`
+	Ties       Ranking_Ties `protobuf:"varint,5,opt,name=Ties,enum=proto.Ranking_Ties" json:"Ties,omitempty"`
 }
 
 func (m *Ranking_Users) Reset()                    { *m = Ranking_Users{} }
 func (m *Ranking_Users) String() string            { return proto1.CompactTextString(m) }
 func (*Ranking_Users) ProtoMessage()               {}
-func (*Ranking_Users) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 6} }
+func (*Ranking_Users) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 17} }
 
 type Ranking_UserList struct {
-	Ranks  []int32 `protobuf:"varint,1,rep,packed,name=Ranks" json:"Ranks,omitempty"`
-	Scores []int32 `protobuf:"varint,2,rep,packed,name=Scores" json:"Scores,omitempty"`
+	Ranks           []int32   `protobuf:"varint,1,rep,packed,name=Ranks" json:"Ranks,omitempty"`
+	Scores          []int32   `protobuf:"varint,2,rep,packed,name=Scores" json:"Scores,omitempty"`
+	Scores64        []int64   `protobuf:"varint,3,rep,packed,name=Scores64" json:"Scores64,omitempty"`
+	ScoresFloat     []float64 `protobuf:"fixed64,4,rep,packed,name=ScoresFloat" json:"ScoresFloat,omitempty"`
+	RanksFractional []float64 `protobuf:"fixed64,5,rep,packed,name=RanksFractional" json:"RanksFractional,omitempty"`
 }
 
 func (m *Ranking_UserList) Reset()                    { *m = Ranking_UserList{} }
 func (m *Ranking_UserList) String() string            { return proto1.CompactTextString(m) }
 func (*Ranking_UserList) ProtoMessage()               {}
-func (*Ranking_UserList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 7} }
+func (*Ranking_UserList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 18} }
+
+type Ranking_AroundUser struct {
+	SetId      uint64       `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	UserId     int32        `protobuf:"varint,2,opt,name=UserId" json:"UserId,omitempty"`
+	Before     int32        `protobuf:"varint,3,opt,name=Before" json:"Before,omitempty"`
+	After      int32        `protobuf:"varint,4,opt,name=After" json:"After,omitempty"`
+	UserId64   int64        `protobuf:"varint,5,opt,name=UserId64" json:"UserId64,omitempty"`
+	Generation int32        `protobuf:"varint,6,opt,name=Generation" json:"Generation,omitempty"`
+	Ties       Ranking_Ties `protobuf:"varint,7,opt,name=Ties,enum=proto.Ranking_Ties" json:"Ties,omitempty"`
+}
+
+func (m *Ranking_AroundUser) Reset()                    { *m = Ranking_AroundUser{} }
+func (m *Ranking_AroundUser) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_AroundUser) ProtoMessage()               {}
+func (*Ranking_AroundUser) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 19} }
+
+type Ranking_AroundList struct {
+	UserIds         []int32   `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	Scores          []int32   `protobuf:"varint,2,rep,packed,name=Scores" json:"Scores,omitempty"`
+	Ranks           []int32   `protobuf:"varint,3,rep,packed,name=Ranks" json:"Ranks,omitempty"`
+	UserIds64       []int64   `protobuf:"varint,4,rep,packed,name=UserIds64" json:"UserIds64,omitempty"`
+	Scores64        []int64   `protobuf:"varint,5,rep,packed,name=Scores64" json:"Scores64,omitempty"`
+	ScoresFloat     []float64 `protobuf:"fixed64,6,rep,packed,name=ScoresFloat" json:"ScoresFloat,omitempty"`
+	RanksFractional []float64 `protobuf:"fixed64,7,rep,packed,name=RanksFractional" json:"RanksFractional,omitempty"`
+}
+
+func (m *Ranking_AroundList) Reset()                    { *m = Ranking_AroundList{} }
+func (m *Ranking_AroundList) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_AroundList) ProtoMessage()               {}
+func (*Ranking_AroundList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 20} }
+
+type Ranking_ScoreRange struct {
+	SetId      uint64       `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	Min        int32        `protobuf:"varint,2,opt,name=Min" json:"Min,omitempty"`
+	Max        int32        `protobuf:"varint,3,opt,name=Max" json:"Max,omitempty"`
+	Offset     int32        `protobuf:"varint,4,opt,name=Offset" json:"Offset,omitempty"`
+	Limit      int32        `protobuf:"varint,5,opt,name=Limit" json:"Limit,omitempty"`
+	Min64      int64        `protobuf:"varint,6,opt,name=Min64" json:"Min64,omitempty"`
+	Max64      int64        `protobuf:"varint,7,opt,name=Max64" json:"Max64,omitempty"`
+	MinFloat   float64      `protobuf:"fixed64,8,opt,name=MinFloat" json:"MinFloat,omitempty"`
+	MaxFloat   float64      `protobuf:"fixed64,9,opt,name=MaxFloat" json:"MaxFloat,omitempty"`
+	Generation int32        `protobuf:"varint,10,opt,name=Generation" json:"Generation,omitempty"`
+	Ties       Ranking_Ties `protobuf:"varint,11,opt,name=Ties,enum=proto.Ranking_Ties" json:"Ties,omitempty"`
+}
+
+func (m *Ranking_ScoreRange) Reset()                    { *m = Ranking_ScoreRange{} }
+func (m *Ranking_ScoreRange) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ScoreRange) ProtoMessage()               {}
+func (*Ranking_ScoreRange) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 21} }
+
+type Ranking_ScoreList struct {
+	UserIds         []int32   `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	Scores          []int32   `protobuf:"varint,2,rep,packed,name=Scores" json:"Scores,omitempty"`
+	StartRank       int32     `protobuf:"varint,3,opt,name=StartRank" json:"StartRank,omitempty"`
+	UserIds64       []int64   `protobuf:"varint,4,rep,packed,name=UserIds64" json:"UserIds64,omitempty"`
+	Scores64        []int64   `protobuf:"varint,5,rep,packed,name=Scores64" json:"Scores64,omitempty"`
+	ScoresFloat     []float64 `protobuf:"fixed64,6,rep,packed,name=ScoresFloat" json:"ScoresFloat,omitempty"`
+	Ranks           []int32   `protobuf:"varint,7,rep,packed,name=Ranks" json:"Ranks,omitempty"`
+	RanksFractional []float64 `protobuf:"fixed64,8,rep,packed,name=RanksFractional" json:"RanksFractional,omitempty"`
+}
+
+func (m *Ranking_ScoreList) Reset()                    { *m = Ranking_ScoreList{} }
+func (m *Ranking_ScoreList) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ScoreList) ProtoMessage()               {}
+func (*Ranking_ScoreList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 22} }
+
+type Ranking_ScoreCount struct {
+	SetId      uint64  `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	Min        int32   `protobuf:"varint,2,opt,name=Min" json:"Min,omitempty"`
+	Max        int32   `protobuf:"varint,3,opt,name=Max" json:"Max,omitempty"`
+	Min64      int64   `protobuf:"varint,4,opt,name=Min64" json:"Min64,omitempty"`
+	Max64      int64   `protobuf:"varint,5,opt,name=Max64" json:"Max64,omitempty"`
+	MinFloat   float64 `protobuf:"fixed64,6,opt,name=MinFloat" json:"MinFloat,omitempty"`
+	MaxFloat   float64 `protobuf:"fixed64,7,opt,name=MaxFloat" json:"MaxFloat,omitempty"`
+	Generation int32   `protobuf:"varint,8,opt,name=Generation" json:"Generation,omitempty"`
+}
+
+func (m *Ranking_ScoreCount) Reset()                    { *m = Ranking_ScoreCount{} }
+func (m *Ranking_ScoreCount) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_ScoreCount) ProtoMessage()               {}
+func (*Ranking_ScoreCount) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 23} }
+
+type Ranking_Count struct {
+	Count int32 `protobuf:"varint,1,opt,name=Count" json:"Count,omitempty"`
+}
+
+func (m *Ranking_Count) Reset()                    { *m = Ranking_Count{} }
+func (m *Ranking_Count) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Count) ProtoMessage()               {}
+func (*Ranking_Count) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 24} }
+
+type Ranking_Aggregate struct {
+	DestId      uint64              `protobuf:"varint,1,opt,name=DestId" json:"DestId,omitempty"`
+	SourceIds   []uint64            `protobuf:"varint,2,rep,packed,name=SourceIds" json:"SourceIds,omitempty"`
+	Weights     []float64           `protobuf:"fixed64,3,rep,packed,name=Weights" json:"Weights,omitempty"`
+	Aggregation Ranking_Aggregation `protobuf:"varint,4,opt,name=Aggregation,enum=proto.Ranking_Aggregation" json:"Aggregation,omitempty"`
+	Intersect   bool                `protobuf:"varint,5,opt,name=Intersect" json:"Intersect,omitempty"`
+	Continuous  bool                `protobuf:"varint,6,opt,name=Continuous" json:"Continuous,omitempty"`
+	Group       bool                `protobuf:"varint,7,opt,name=Group" json:"Group,omitempty"`
+}
+
+func (m *Ranking_Aggregate) Reset()                    { *m = Ranking_Aggregate{} }
+func (m *Ranking_Aggregate) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Aggregate) ProtoMessage()               {}
+func (*Ranking_Aggregate) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 25} }
+
+type Ranking_Membership struct {
+	SetId   uint64  `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	UserIds []int64 `protobuf:"varint,2,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	GroupId int64   `protobuf:"varint,3,opt,name=GroupId" json:"GroupId,omitempty"`
+}
+
+func (m *Ranking_Membership) Reset()                    { *m = Ranking_Membership{} }
+func (m *Ranking_Membership) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Membership) ProtoMessage()               {}
+func (*Ranking_Membership) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 26} }
+
+type Ranking_Group struct {
+	SetId   uint64 `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	GroupId int64  `protobuf:"varint,2,opt,name=GroupId" json:"GroupId,omitempty"`
+}
+
+func (m *Ranking_Group) Reset()                    { *m = Ranking_Group{} }
+func (m *Ranking_Group) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Group) ProtoMessage()               {}
+func (*Ranking_Group) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 27} }
+
+type Ranking_Members struct {
+	UserIds []int64 `protobuf:"varint,1,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+}
+
+func (m *Ranking_Members) Reset()                    { *m = Ranking_Members{} }
+func (m *Ranking_Members) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Members) ProtoMessage()               {}
+func (*Ranking_Members) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 28} }
+
+type Ranking_SnapshotRequest struct {
+	SetIds []uint64 `protobuf:"varint,1,rep,packed,name=SetIds" json:"SetIds,omitempty"`
+}
+
+func (m *Ranking_SnapshotRequest) Reset()                    { *m = Ranking_SnapshotRequest{} }
+func (m *Ranking_SnapshotRequest) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_SnapshotRequest) ProtoMessage()               {}
+func (*Ranking_SnapshotRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 29} }
+
+type Ranking_Chunk struct {
+	Data []byte `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *Ranking_Chunk) Reset()                    { *m = Ranking_Chunk{} }
+func (m *Ranking_Chunk) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_Chunk) ProtoMessage()               {}
+func (*Ranking_Chunk) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 30} }
+
+type Ranking_WatchTop struct {
+	SetId uint64 `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	Top   int32  `protobuf:"varint,2,opt,name=Top" json:"Top,omitempty"`
+}
+
+func (m *Ranking_WatchTop) Reset()                    { *m = Ranking_WatchTop{} }
+func (m *Ranking_WatchTop) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_WatchTop) ProtoMessage()               {}
+func (*Ranking_WatchTop) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 31} }
+
+type Ranking_WatchUsers struct {
+	SetId     uint64  `protobuf:"varint,1,opt,name=SetId" json:"SetId,omitempty"`
+	UserIds   []int32 `protobuf:"varint,2,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	UserIds64 []int64 `protobuf:"varint,3,rep,packed,name=UserIds64" json:"UserIds64,omitempty"`
+}
+
+func (m *Ranking_WatchUsers) Reset()                    { *m = Ranking_WatchUsers{} }
+func (m *Ranking_WatchUsers) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_WatchUsers) ProtoMessage()               {}
+func (*Ranking_WatchUsers) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 32} }
+
+type Ranking_UserEvent struct {
+	UserId     int32   `protobuf:"varint,1,opt,name=UserId" json:"UserId,omitempty"`
+	Rank       int32   `protobuf:"varint,2,opt,name=Rank" json:"Rank,omitempty"`
+	OldRank    int32   `protobuf:"varint,3,opt,name=OldRank" json:"OldRank,omitempty"`
+	Score      int32   `protobuf:"varint,4,opt,name=Score" json:"Score,omitempty"`
+	By         int32   `protobuf:"varint,5,opt,name=By" json:"By,omitempty"`
+	UserId64   int64   `protobuf:"varint,6,opt,name=UserId64" json:"UserId64,omitempty"`
+	Score64    int64   `protobuf:"varint,7,opt,name=Score64" json:"Score64,omitempty"`
+	By64       int64   `protobuf:"varint,8,opt,name=By64" json:"By64,omitempty"`
+	ScoreFloat float64 `protobuf:"fixed64,9,opt,name=ScoreFloat" json:"ScoreFloat,omitempty"`
+}
+
+func (m *Ranking_UserEvent) Reset()                    { *m = Ranking_UserEvent{} }
+func (m *Ranking_UserEvent) String() string            { return proto1.CompactTextString(m) }
+func (*Ranking_UserEvent) ProtoMessage()               {}
+func (*Ranking_UserEvent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 33} }
 
 func init() {
 	proto1.RegisterType((*Ranking)(nil), "proto.Ranking")
 	proto1.RegisterType((*Ranking_Nil)(nil), "proto.Ranking.Nil")
 	proto1.RegisterType((*Ranking_SetId)(nil), "proto.Ranking.SetId")
+	proto1.RegisterType((*Ranking_CreateSet)(nil), "proto.Ranking.CreateSet")
+	proto1.RegisterType((*Ranking_SetExpiry)(nil), "proto.Ranking.SetExpiry")
+	proto1.RegisterType((*Ranking_SetInfo)(nil), "proto.Ranking.SetInfo")
+	proto1.RegisterType((*Ranking_ListSets)(nil), "proto.Ranking.ListSets")
+	proto1.RegisterType((*Ranking_SetInfos)(nil), "proto.Ranking.SetInfos")
 	proto1.RegisterType((*Ranking_DeleteUserRequest)(nil), "proto.Ranking.DeleteUserRequest")
 	proto1.RegisterType((*Ranking_Change)(nil), "proto.Ranking.Change")
+	proto1.RegisterType((*Ranking_ChangeResult)(nil), "proto.Ranking.ChangeResult")
+	proto1.RegisterType((*Ranking_Ack)(nil), "proto.Ranking.Ack")
+	proto1.RegisterType((*Ranking_ChangeBatch)(nil), "proto.Ranking.ChangeBatch")
+	proto1.RegisterType((*Ranking_ChangeBatchResult)(nil), "proto.Ranking.ChangeBatchResult")
+	proto1.RegisterType((*Ranking_Increment)(nil), "proto.Ranking.Increment")
+	proto1.RegisterType((*Ranking_UserRank)(nil), "proto.Ranking.UserRank")
 	proto1.RegisterType((*Ranking_Range)(nil), "proto.Ranking.Range")
 	proto1.RegisterType((*Ranking_RankList)(nil), "proto.Ranking.RankList")
 	proto1.RegisterType((*Ranking_Users)(nil), "proto.Ranking.Users")
 	proto1.RegisterType((*Ranking_UserList)(nil), "proto.Ranking.UserList")
+	proto1.RegisterType((*Ranking_AroundUser)(nil), "proto.Ranking.AroundUser")
+	proto1.RegisterType((*Ranking_AroundList)(nil), "proto.Ranking.AroundList")
+	proto1.RegisterType((*Ranking_ScoreRange)(nil), "proto.Ranking.ScoreRange")
+	proto1.RegisterType((*Ranking_ScoreList)(nil), "proto.Ranking.ScoreList")
+	proto1.RegisterType((*Ranking_ScoreCount)(nil), "proto.Ranking.ScoreCount")
+	proto1.RegisterType((*Ranking_Count)(nil), "proto.Ranking.Count")
+	proto1.RegisterType((*Ranking_Aggregate)(nil), "proto.Ranking.Aggregate")
+	proto1.RegisterType((*Ranking_Membership)(nil), "proto.Ranking.Membership")
+	proto1.RegisterType((*Ranking_Group)(nil), "proto.Ranking.Group")
+	proto1.RegisterType((*Ranking_Members)(nil), "proto.Ranking.Members")
+	proto1.RegisterType((*Ranking_SnapshotRequest)(nil), "proto.Ranking.SnapshotRequest")
+	proto1.RegisterType((*Ranking_Chunk)(nil), "proto.Ranking.Chunk")
+	proto1.RegisterType((*Ranking_WatchTop)(nil), "proto.Ranking.WatchTop")
+	proto1.RegisterType((*Ranking_WatchUsers)(nil), "proto.Ranking.WatchUsers")
+	proto1.RegisterType((*Ranking_UserEvent)(nil), "proto.Ranking.UserEvent")
+	proto1.RegisterEnum("proto.Ranking_Mode", Ranking_Mode_name, Ranking_Mode_value)
+	proto1.RegisterEnum("proto.Ranking_Order", Ranking_Order_name, Ranking_Order_value)
+	proto1.RegisterEnum("proto.Ranking_Period", Ranking_Period_name, Ranking_Period_value)
+	proto1.RegisterEnum("proto.Ranking_Aggregation", Ranking_Aggregation_name, Ranking_Aggregation_value)
+	proto1.RegisterEnum("proto.Ranking_Ties", Ranking_Ties_name, Ranking_Ties_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -143,11 +694,29 @@ const _ = grpc.SupportPackageIsVersion3
 // Client API for RankingService service
 
 type RankingServiceClient interface {
-	RankChange(ctx context.Context, in *Ranking_Change, opts ...grpc.CallOption) (*Ranking_Nil, error)
+	RankChange(ctx context.Context, in *Ranking_Change, opts ...grpc.CallOption) (*Ranking_ChangeResult, error)
+	StreamRankChanges(ctx context.Context, opts ...grpc.CallOption) (RankingService_StreamRankChangesClient, error)
+	RankChangeBatch(ctx context.Context, in *Ranking_ChangeBatch, opts ...grpc.CallOption) (*Ranking_ChangeBatchResult, error)
+	IncrementScore(ctx context.Context, in *Ranking_Increment, opts ...grpc.CallOption) (*Ranking_UserRank, error)
+	CreateSet(ctx context.Context, in *Ranking_CreateSet, opts ...grpc.CallOption) (*Ranking_Nil, error)
+	DescribeSet(ctx context.Context, in *Ranking_SetId, opts ...grpc.CallOption) (*Ranking_SetInfo, error)
+	ListSets(ctx context.Context, in *Ranking_ListSets, opts ...grpc.CallOption) (*Ranking_SetInfos, error)
 	DeleteSet(ctx context.Context, in *Ranking_SetId, opts ...grpc.CallOption) (*Ranking_Nil, error)
+	SetExpiry(ctx context.Context, in *Ranking_SetExpiry, opts ...grpc.CallOption) (*Ranking_Nil, error)
 	DeleteUser(ctx context.Context, in *Ranking_DeleteUserRequest, opts ...grpc.CallOption) (*Ranking_Nil, error)
 	QueryRankRange(ctx context.Context, in *Ranking_Range, opts ...grpc.CallOption) (*Ranking_RankList, error)
 	QueryUsers(ctx context.Context, in *Ranking_Users, opts ...grpc.CallOption) (*Ranking_UserList, error)
+	QueryAroundUser(ctx context.Context, in *Ranking_AroundUser, opts ...grpc.CallOption) (*Ranking_AroundList, error)
+	QueryScoreRange(ctx context.Context, in *Ranking_ScoreRange, opts ...grpc.CallOption) (*Ranking_ScoreList, error)
+	WatchTop(ctx context.Context, in *Ranking_WatchTop, opts ...grpc.CallOption) (RankingService_WatchTopClient, error)
+	WatchUsers(ctx context.Context, in *Ranking_WatchUsers, opts ...grpc.CallOption) (RankingService_WatchUsersClient, error)
+	CountScoreRange(ctx context.Context, in *Ranking_ScoreCount, opts ...grpc.CallOption) (*Ranking_Count, error)
+	AggregateSets(ctx context.Context, in *Ranking_Aggregate, opts ...grpc.CallOption) (*Ranking_Count, error)
+	JoinGroup(ctx context.Context, in *Ranking_Membership, opts ...grpc.CallOption) (*Ranking_Nil, error)
+	LeaveGroup(ctx context.Context, in *Ranking_Membership, opts ...grpc.CallOption) (*Ranking_Nil, error)
+	QueryGroupMembers(ctx context.Context, in *Ranking_Group, opts ...grpc.CallOption) (*Ranking_Members, error)
+	Snapshot(ctx context.Context, in *Ranking_SnapshotRequest, opts ...grpc.CallOption) (RankingService_SnapshotClient, error)
+	Restore(ctx context.Context, opts ...grpc.CallOption) (RankingService_RestoreClient, error)
 }
 
 type rankingServiceClient struct {
@@ -158,8 +727,8 @@ func NewRankingServiceClient(cc *grpc.ClientConn) RankingServiceClient {
 	return &rankingServiceClient{cc}
 }
 
-func (c *rankingServiceClient) RankChange(ctx context.Context, in *Ranking_Change, opts ...grpc.CallOption) (*Ranking_Nil, error) {
-	out := new(Ranking_Nil)
+func (c *rankingServiceClient) RankChange(ctx context.Context, in *Ranking_Change, opts ...grpc.CallOption) (*Ranking_ChangeResult, error) {
+	out := new(Ranking_ChangeResult)
 	err := grpc.Invoke(ctx, "/proto.RankingService/RankChange", in, out, c.cc, opts...)
 	if err != nil {
 		return nil, err
@@ -167,6 +736,82 @@ func (c *rankingServiceClient) RankChange(ctx context.Context, in *Ranking_Chang
 	return out, nil
 }
 
+func (c *rankingServiceClient) StreamRankChanges(ctx context.Context, opts ...grpc.CallOption) (RankingService_StreamRankChangesClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RankingService_serviceDesc.Streams[0], c.cc, "/proto.RankingService/StreamRankChanges", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rankingServiceStreamRankChangesClient{stream}
+	return x, nil
+}
+
+type RankingService_StreamRankChangesClient interface {
+	Send(*Ranking_Change) error
+	Recv() (*Ranking_Ack, error)
+	grpc.ClientStream
+}
+
+type rankingServiceStreamRankChangesClient struct {
+	grpc.ClientStream
+}
+
+func (x *rankingServiceStreamRankChangesClient) Send(m *Ranking_Change) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *rankingServiceStreamRankChangesClient) Recv() (*Ranking_Ack, error) {
+	m := new(Ranking_Ack)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *rankingServiceClient) RankChangeBatch(ctx context.Context, in *Ranking_ChangeBatch, opts ...grpc.CallOption) (*Ranking_ChangeBatchResult, error) {
+	out := new(Ranking_ChangeBatchResult)
+	err := grpc.Invoke(ctx, "/proto.RankingService/RankChangeBatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) IncrementScore(ctx context.Context, in *Ranking_Increment, opts ...grpc.CallOption) (*Ranking_UserRank, error) {
+	out := new(Ranking_UserRank)
+	err := grpc.Invoke(ctx, "/proto.RankingService/IncrementScore", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) CreateSet(ctx context.Context, in *Ranking_CreateSet, opts ...grpc.CallOption) (*Ranking_Nil, error) {
+	out := new(Ranking_Nil)
+	err := grpc.Invoke(ctx, "/proto.RankingService/CreateSet", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) DescribeSet(ctx context.Context, in *Ranking_SetId, opts ...grpc.CallOption) (*Ranking_SetInfo, error) {
+	out := new(Ranking_SetInfo)
+	err := grpc.Invoke(ctx, "/proto.RankingService/DescribeSet", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) ListSets(ctx context.Context, in *Ranking_ListSets, opts ...grpc.CallOption) (*Ranking_SetInfos, error) {
+	out := new(Ranking_SetInfos)
+	err := grpc.Invoke(ctx, "/proto.RankingService/ListSets", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *rankingServiceClient) DeleteSet(ctx context.Context, in *Ranking_SetId, opts ...grpc.CallOption) (*Ranking_Nil, error) {
 	out := new(Ranking_Nil)
 	err := grpc.Invoke(ctx, "/proto.RankingService/DeleteSet", in, out, c.cc, opts...)
@@ -176,6 +821,15 @@ func (c *rankingServiceClient) DeleteSet(ctx context.Context, in *Ranking_SetId,
 	return out, nil
 }
 
+func (c *rankingServiceClient) SetExpiry(ctx context.Context, in *Ranking_SetExpiry, opts ...grpc.CallOption) (*Ranking_Nil, error) {
+	out := new(Ranking_Nil)
+	err := grpc.Invoke(ctx, "/proto.RankingService/SetExpiry", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *rankingServiceClient) DeleteUser(ctx context.Context, in *Ranking_DeleteUserRequest, opts ...grpc.CallOption) (*Ranking_Nil, error) {
 	out := new(Ranking_Nil)
 	err := grpc.Invoke(ctx, "/proto.RankingService/DeleteUser", in, out, c.cc, opts...)
@@ -203,77 +857,422 @@ func (c *rankingServiceClient) QueryUsers(ctx context.Context, in *Ranking_Users
 	return out, nil
 }
 
-// Server API for RankingService service
-
-type RankingServiceServer interface {
-	RankChange(context.Context, *Ranking_Change) (*Ranking_Nil, error)
-	DeleteSet(context.Context, *Ranking_SetId) (*Ranking_Nil, error)
-	DeleteUser(context.Context, *Ranking_DeleteUserRequest) (*Ranking_Nil, error)
-	QueryRankRange(context.Context, *Ranking_Range) (*Ranking_RankList, error)
-	QueryUsers(context.Context, *Ranking_Users) (*Ranking_UserList, error)
+func (c *rankingServiceClient) QueryAroundUser(ctx context.Context, in *Ranking_AroundUser, opts ...grpc.CallOption) (*Ranking_AroundList, error) {
+	out := new(Ranking_AroundList)
+	err := grpc.Invoke(ctx, "/proto.RankingService/QueryAroundUser", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func RegisterRankingServiceServer(s *grpc.Server, srv RankingServiceServer) {
-	s.RegisterService(&_RankingService_serviceDesc, srv)
+func (c *rankingServiceClient) QueryScoreRange(ctx context.Context, in *Ranking_ScoreRange, opts ...grpc.CallOption) (*Ranking_ScoreList, error) {
+	out := new(Ranking_ScoreList)
+	err := grpc.Invoke(ctx, "/proto.RankingService/QueryScoreRange", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func _RankingService_RankChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Ranking_Change)
-	if err := dec(in); err != nil {
+func (c *rankingServiceClient) WatchTop(ctx context.Context, in *Ranking_WatchTop, opts ...grpc.CallOption) (RankingService_WatchTopClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RankingService_serviceDesc.Streams[1], c.cc, "/proto.RankingService/WatchTop", opts...)
+	if err != nil {
 		return nil, err
 	}
-	if interceptor == nil {
-		return srv.(RankingServiceServer).RankChange(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/proto.RankingService/RankChange",
+	x := &rankingServiceWatchTopClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(RankingServiceServer).RankChange(ctx, req.(*Ranking_Change))
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
 	}
-	return interceptor(ctx, in, info, handler)
+	return x, nil
 }
 
-func _RankingService_DeleteSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Ranking_SetId)
-	if err := dec(in); err != nil {
+type RankingService_WatchTopClient interface {
+	Recv() (*Ranking_RankList, error)
+	grpc.ClientStream
+}
+
+type rankingServiceWatchTopClient struct {
+	grpc.ClientStream
+}
+
+func (x *rankingServiceWatchTopClient) Recv() (*Ranking_RankList, error) {
+	m := new(Ranking_RankList)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
-	if interceptor == nil {
-		return srv.(RankingServiceServer).DeleteSet(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/proto.RankingService/DeleteSet",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(RankingServiceServer).DeleteSet(ctx, req.(*Ranking_SetId))
-	}
-	return interceptor(ctx, in, info, handler)
+	return m, nil
 }
 
-func _RankingService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Ranking_DeleteUserRequest)
-	if err := dec(in); err != nil {
+func (c *rankingServiceClient) WatchUsers(ctx context.Context, in *Ranking_WatchUsers, opts ...grpc.CallOption) (RankingService_WatchUsersClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RankingService_serviceDesc.Streams[2], c.cc, "/proto.RankingService/WatchUsers", opts...)
+	if err != nil {
 		return nil, err
 	}
-	if interceptor == nil {
-		return srv.(RankingServiceServer).DeleteUser(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/proto.RankingService/DeleteUser",
+	x := &rankingServiceWatchUsersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(RankingServiceServer).DeleteUser(ctx, req.(*Ranking_DeleteUserRequest))
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
 	}
-	return interceptor(ctx, in, info, handler)
+	return x, nil
 }
 
-func _RankingService_QueryRankRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Ranking_Range)
-	if err := dec(in); err != nil {
+type RankingService_WatchUsersClient interface {
+	Recv() (*Ranking_UserEvent, error)
+	grpc.ClientStream
+}
+
+type rankingServiceWatchUsersClient struct {
+	grpc.ClientStream
+}
+
+func (x *rankingServiceWatchUsersClient) Recv() (*Ranking_UserEvent, error) {
+	m := new(Ranking_UserEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *rankingServiceClient) CountScoreRange(ctx context.Context, in *Ranking_ScoreCount, opts ...grpc.CallOption) (*Ranking_Count, error) {
+	out := new(Ranking_Count)
+	err := grpc.Invoke(ctx, "/proto.RankingService/CountScoreRange", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) AggregateSets(ctx context.Context, in *Ranking_Aggregate, opts ...grpc.CallOption) (*Ranking_Count, error) {
+	out := new(Ranking_Count)
+	err := grpc.Invoke(ctx, "/proto.RankingService/AggregateSets", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) JoinGroup(ctx context.Context, in *Ranking_Membership, opts ...grpc.CallOption) (*Ranking_Nil, error) {
+	out := new(Ranking_Nil)
+	err := grpc.Invoke(ctx, "/proto.RankingService/JoinGroup", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) LeaveGroup(ctx context.Context, in *Ranking_Membership, opts ...grpc.CallOption) (*Ranking_Nil, error) {
+	out := new(Ranking_Nil)
+	err := grpc.Invoke(ctx, "/proto.RankingService/LeaveGroup", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) QueryGroupMembers(ctx context.Context, in *Ranking_Group, opts ...grpc.CallOption) (*Ranking_Members, error) {
+	out := new(Ranking_Members)
+	err := grpc.Invoke(ctx, "/proto.RankingService/QueryGroupMembers", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) Snapshot(ctx context.Context, in *Ranking_SnapshotRequest, opts ...grpc.CallOption) (RankingService_SnapshotClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RankingService_serviceDesc.Streams[3], c.cc, "/proto.RankingService/Snapshot", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rankingServiceSnapshotClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RankingService_SnapshotClient interface {
+	Recv() (*Ranking_Chunk, error)
+	grpc.ClientStream
+}
+
+type rankingServiceSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *rankingServiceSnapshotClient) Recv() (*Ranking_Chunk, error) {
+	m := new(Ranking_Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *rankingServiceClient) Restore(ctx context.Context, opts ...grpc.CallOption) (RankingService_RestoreClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RankingService_serviceDesc.Streams[4], c.cc, "/proto.RankingService/Restore", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rankingServiceRestoreClient{stream}
+	return x, nil
+}
+
+type RankingService_RestoreClient interface {
+	Send(*Ranking_Chunk) error
+	CloseAndRecv() (*Ranking_Count, error)
+	grpc.ClientStream
+}
+
+type rankingServiceRestoreClient struct {
+	grpc.ClientStream
+}
+
+func (x *rankingServiceRestoreClient) Send(m *Ranking_Chunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *rankingServiceRestoreClient) CloseAndRecv() (*Ranking_Count, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Ranking_Count)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for RankingService service
+
+type RankingServiceServer interface {
+	RankChange(context.Context, *Ranking_Change) (*Ranking_ChangeResult, error)
+	StreamRankChanges(RankingService_StreamRankChangesServer) error
+	RankChangeBatch(context.Context, *Ranking_ChangeBatch) (*Ranking_ChangeBatchResult, error)
+	IncrementScore(context.Context, *Ranking_Increment) (*Ranking_UserRank, error)
+	CreateSet(context.Context, *Ranking_CreateSet) (*Ranking_Nil, error)
+	DescribeSet(context.Context, *Ranking_SetId) (*Ranking_SetInfo, error)
+	ListSets(context.Context, *Ranking_ListSets) (*Ranking_SetInfos, error)
+	DeleteSet(context.Context, *Ranking_SetId) (*Ranking_Nil, error)
+	SetExpiry(context.Context, *Ranking_SetExpiry) (*Ranking_Nil, error)
+	DeleteUser(context.Context, *Ranking_DeleteUserRequest) (*Ranking_Nil, error)
+	QueryRankRange(context.Context, *Ranking_Range) (*Ranking_RankList, error)
+	QueryUsers(context.Context, *Ranking_Users) (*Ranking_UserList, error)
+	QueryAroundUser(context.Context, *Ranking_AroundUser) (*Ranking_AroundList, error)
+	QueryScoreRange(context.Context, *Ranking_ScoreRange) (*Ranking_ScoreList, error)
+	WatchTop(*Ranking_WatchTop, RankingService_WatchTopServer) error
+	WatchUsers(*Ranking_WatchUsers, RankingService_WatchUsersServer) error
+	CountScoreRange(context.Context, *Ranking_ScoreCount) (*Ranking_Count, error)
+	AggregateSets(context.Context, *Ranking_Aggregate) (*Ranking_Count, error)
+	JoinGroup(context.Context, *Ranking_Membership) (*Ranking_Nil, error)
+	LeaveGroup(context.Context, *Ranking_Membership) (*Ranking_Nil, error)
+	QueryGroupMembers(context.Context, *Ranking_Group) (*Ranking_Members, error)
+	Snapshot(*Ranking_SnapshotRequest, RankingService_SnapshotServer) error
+	Restore(RankingService_RestoreServer) error
+}
+
+func RegisterRankingServiceServer(s *grpc.Server, srv RankingServiceServer) {
+	s.RegisterService(&_RankingService_serviceDesc, srv)
+}
+
+func _RankingService_RankChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Change)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).RankChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/RankChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).RankChange(ctx, req.(*Ranking_Change))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_StreamRankChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RankingServiceServer).StreamRankChanges(&rankingServiceStreamRankChangesServer{stream})
+}
+
+type RankingService_StreamRankChangesServer interface {
+	Send(*Ranking_Ack) error
+	Recv() (*Ranking_Change, error)
+	grpc.ServerStream
+}
+
+type rankingServiceStreamRankChangesServer struct {
+	grpc.ServerStream
+}
+
+func (x *rankingServiceStreamRankChangesServer) Send(m *Ranking_Ack) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *rankingServiceStreamRankChangesServer) Recv() (*Ranking_Change, error) {
+	m := new(Ranking_Change)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _RankingService_RankChangeBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_ChangeBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).RankChangeBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/RankChangeBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).RankChangeBatch(ctx, req.(*Ranking_ChangeBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_IncrementScore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Increment)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).IncrementScore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/IncrementScore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).IncrementScore(ctx, req.(*Ranking_Increment))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_CreateSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_CreateSet)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).CreateSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/CreateSet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).CreateSet(ctx, req.(*Ranking_CreateSet))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_DescribeSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_SetId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).DescribeSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/DescribeSet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).DescribeSet(ctx, req.(*Ranking_SetId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_ListSets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_ListSets)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).ListSets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/ListSets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).ListSets(ctx, req.(*Ranking_ListSets))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_DeleteSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_SetId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).DeleteSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/DeleteSet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).DeleteSet(ctx, req.(*Ranking_SetId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_SetExpiry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_SetExpiry)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).SetExpiry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/SetExpiry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).SetExpiry(ctx, req.(*Ranking_SetExpiry))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_DeleteUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/DeleteUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).DeleteUser(ctx, req.(*Ranking_DeleteUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_QueryRankRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Range)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
@@ -307,6 +1306,221 @@ func _RankingService_QueryUsers_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RankingService_QueryAroundUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_AroundUser)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).QueryAroundUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/QueryAroundUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).QueryAroundUser(ctx, req.(*Ranking_AroundUser))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_QueryScoreRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_ScoreRange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).QueryScoreRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/QueryScoreRange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).QueryScoreRange(ctx, req.(*Ranking_ScoreRange))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_WatchTop_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Ranking_WatchTop)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RankingServiceServer).WatchTop(m, &rankingServiceWatchTopServer{stream})
+}
+
+type RankingService_WatchTopServer interface {
+	Send(*Ranking_RankList) error
+	grpc.ServerStream
+}
+
+type rankingServiceWatchTopServer struct {
+	grpc.ServerStream
+}
+
+func (x *rankingServiceWatchTopServer) Send(m *Ranking_RankList) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RankingService_WatchUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Ranking_WatchUsers)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RankingServiceServer).WatchUsers(m, &rankingServiceWatchUsersServer{stream})
+}
+
+type RankingService_WatchUsersServer interface {
+	Send(*Ranking_UserEvent) error
+	grpc.ServerStream
+}
+
+type rankingServiceWatchUsersServer struct {
+	grpc.ServerStream
+}
+
+func (x *rankingServiceWatchUsersServer) Send(m *Ranking_UserEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RankingService_CountScoreRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_ScoreCount)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).CountScoreRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/CountScoreRange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).CountScoreRange(ctx, req.(*Ranking_ScoreCount))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_AggregateSets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Aggregate)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).AggregateSets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/AggregateSets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).AggregateSets(ctx, req.(*Ranking_Aggregate))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_JoinGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Membership)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).JoinGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/JoinGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).JoinGroup(ctx, req.(*Ranking_Membership))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_LeaveGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Membership)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).LeaveGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/LeaveGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).LeaveGroup(ctx, req.(*Ranking_Membership))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_QueryGroupMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ranking_Group)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).QueryGroupMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.RankingService/QueryGroupMembers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).QueryGroupMembers(ctx, req.(*Ranking_Group))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_Snapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Ranking_SnapshotRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RankingServiceServer).Snapshot(m, &rankingServiceSnapshotServer{stream})
+}
+
+type RankingService_SnapshotServer interface {
+	Send(*Ranking_Chunk) error
+	grpc.ServerStream
+}
+
+type rankingServiceSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *rankingServiceSnapshotServer) Send(m *Ranking_Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RankingService_Restore_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RankingServiceServer).Restore(&rankingServiceRestoreServer{stream})
+}
+
+type RankingService_RestoreServer interface {
+	SendAndClose(*Ranking_Count) error
+	Recv() (*Ranking_Chunk, error)
+	grpc.ServerStream
+}
+
+type rankingServiceRestoreServer struct {
+	grpc.ServerStream
+}
+
+func (x *rankingServiceRestoreServer) SendAndClose(m *Ranking_Count) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *rankingServiceRestoreServer) Recv() (*Ranking_Chunk, error) {
+	m := new(Ranking_Chunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _RankingService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.RankingService",
 	HandlerType: (*RankingServiceServer)(nil),
@@ -315,10 +1529,34 @@ var _RankingService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RankChange",
 			Handler:    _RankingService_RankChange_Handler,
 		},
+		{
+			MethodName: "RankChangeBatch",
+			Handler:    _RankingService_RankChangeBatch_Handler,
+		},
+		{
+			MethodName: "IncrementScore",
+			Handler:    _RankingService_IncrementScore_Handler,
+		},
+		{
+			MethodName: "CreateSet",
+			Handler:    _RankingService_CreateSet_Handler,
+		},
+		{
+			MethodName: "DescribeSet",
+			Handler:    _RankingService_DescribeSet_Handler,
+		},
+		{
+			MethodName: "ListSets",
+			Handler:    _RankingService_ListSets_Handler,
+		},
 		{
 			MethodName: "DeleteSet",
 			Handler:    _RankingService_DeleteSet_Handler,
 		},
+		{
+			MethodName: "SetExpiry",
+			Handler:    _RankingService_SetExpiry_Handler,
+		},
 		{
 			MethodName: "DeleteUser",
 			Handler:    _RankingService_DeleteUser_Handler,
@@ -331,34 +1569,186 @@ var _RankingService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "QueryUsers",
 			Handler:    _RankingService_QueryUsers_Handler,
 		},
+		{
+			MethodName: "QueryAroundUser",
+			Handler:    _RankingService_QueryAroundUser_Handler,
+		},
+		{
+			MethodName: "QueryScoreRange",
+			Handler:    _RankingService_QueryScoreRange_Handler,
+		},
+		{
+			MethodName: "CountScoreRange",
+			Handler:    _RankingService_CountScoreRange_Handler,
+		},
+		{
+			MethodName: "AggregateSets",
+			Handler:    _RankingService_AggregateSets_Handler,
+		},
+		{
+			MethodName: "JoinGroup",
+			Handler:    _RankingService_JoinGroup_Handler,
+		},
+		{
+			MethodName: "LeaveGroup",
+			Handler:    _RankingService_LeaveGroup_Handler,
+		},
+		{
+			MethodName: "QueryGroupMembers",
+			Handler:    _RankingService_QueryGroupMembers_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRankChanges",
+			Handler:       _RankingService_StreamRankChanges_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchTop",
+			Handler:       _RankingService_WatchTop_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchUsers",
+			Handler:       _RankingService_WatchUsers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Snapshot",
+			Handler:       _RankingService_Snapshot_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Restore",
+			Handler:       _RankingService_Restore_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: fileDescriptor0,
 }
 
 func init() { proto1.RegisterFile("rankserver.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 332 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x91, 0x5f, 0x4b, 0x32, 0x41,
-	0x18, 0xc5, 0x99, 0xf5, 0x9d, 0x55, 0x0f, 0xbc, 0xa2, 0xd3, 0xbf, 0x65, 0xae, 0x96, 0xae, 0x84,
-	0x42, 0x48, 0xa9, 0x2e, 0xba, 0x88, 0xac, 0x1b, 0x21, 0x84, 0x94, 0x3e, 0x80, 0xe9, 0x83, 0x2d,
-	0xca, 0x5a, 0x33, 0xab, 0xd0, 0xd7, 0xeb, 0x4b, 0xf4, 0x75, 0x62, 0x9e, 0x59, 0x33, 0xd6, 0x85,
-	0xae, 0x76, 0x39, 0xf3, 0x3b, 0xcf, 0x99, 0x79, 0x0e, 0x9a, 0x66, 0x92, 0x2e, 0x2c, 0x99, 0x0d,
-	0x99, 0xce, 0x9b, 0x59, 0x65, 0x2b, 0x25, 0xf9, 0x73, 0xfa, 0x15, 0xa0, 0x3a, 0x9a, 0xa4, 0x8b,
-	0x24, 0x9d, 0x6b, 0x89, 0xca, 0x30, 0x59, 0xea, 0x63, 0xc8, 0x31, 0x65, 0x83, 0x99, 0xfa, 0x9f,
-	0xff, 0x44, 0x22, 0x16, 0xed, 0x7f, 0xba, 0x8b, 0xd6, 0x03, 0x2d, 0x29, 0xa3, 0x67, 0x4b, 0x66,
-	0x44, 0xef, 0x6b, 0xb2, 0x59, 0x81, 0x51, 0x0d, 0x84, 0xee, 0x74, 0x30, 0x8b, 0x82, 0x58, 0xb4,
-	0xa5, 0xbe, 0x42, 0x78, 0xff, 0x3a, 0x49, 0xe7, 0xf4, 0xeb, 0xc4, 0x91, 0x92, 0x8d, 0xd3, 0x95,
-	0x21, 0x0f, 0xee, 0xe6, 0x54, 0x38, 0xeb, 0x1c, 0x72, 0xc4, 0xb6, 0x3a, 0xc4, 0x5d, 0xee, 0xa8,
-	0x43, 0xf4, 0xcb, 0xe9, 0x1e, 0x6a, 0xee, 0x0d, 0x8f, 0x89, 0xcd, 0xd4, 0x01, 0xaa, 0x3e, 0xc7,
-	0x46, 0x22, 0xae, 0xb4, 0x65, 0x3f, 0x68, 0x0a, 0xa5, 0x10, 0x72, 0x98, 0x8d, 0x82, 0xad, 0xa6,
-	0xcf, 0x20, 0x1d, 0x68, 0xcb, 0x1d, 0x3f, 0x09, 0x01, 0x27, 0x5c, 0xa0, 0xe6, 0x18, 0x4e, 0x68,
-	0xf1, 0xdd, 0x16, 0x7f, 0xcc, 0xef, 0x7e, 0x06, 0x68, 0xe4, 0x9b, 0x1d, 0x93, 0xd9, 0x24, 0x53,
-	0x52, 0xd7, 0x80, 0x53, 0xf2, 0x8d, 0x1c, 0xf9, 0x26, 0x3a, 0x39, 0xd4, 0xf1, 0xb2, 0x56, 0x05,
-	0x79, 0x98, 0x2c, 0xd5, 0x25, 0xea, 0x7e, 0xf5, 0x63, 0xca, 0xd4, 0x61, 0x01, 0xe0, 0x7b, 0x96,
-	0xda, 0xfa, 0xc0, 0xae, 0x31, 0x15, 0x17, 0x88, 0xbd, 0x32, 0x4b, 0x67, 0xdc, 0xa2, 0xf1, 0xb4,
-	0x26, 0xf3, 0xe1, 0x34, 0x5f, 0x49, 0x31, 0x9f, 0x55, 0x7d, 0xb2, 0xaf, 0xfa, 0x42, 0x6e, 0x00,
-	0x1e, 0xe0, 0x97, 0x5d, 0x34, 0xb3, 0xba, 0x67, 0xde, 0xee, 0xfa, 0x25, 0x64, 0xbd, 0xf7, 0x1d,
-	0x00, 0x00, 0xff, 0xff, 0x7f, 0x20, 0x0f, 0x43, 0xc0, 0x02, 0x00, 0x00,
+	// 1875 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xc4, 0x58, 0x4b, 0x6f, 0xe3, 0xd6,
+	0x15, 0x9e, 0x2b, 0x8a, 0x22, 0x75, 0x68, 0x4b, 0xf4, 0x9d, 0x99, 0x0c, 0xc3, 0x00, 0x81, 0xea,
+	0x3c, 0xaa, 0x45, 0x3b, 0x35, 0x1c, 0xc7, 0xed, 0x64, 0x8a, 0x4e, 0xa9, 0xc7, 0xb8, 0x6a, 0xf4,
+	0x48, 0x4d, 0x05, 0x33, 0xb3, 0xe4, 0x48, 0xd7, 0x36, 0x61, 0x99, 0x54, 0x48, 0xca, 0xb5, 0x03,
+	0x64, 0xd1, 0x75, 0x97, 0xdd, 0x15, 0x5d, 0x76, 0x53, 0x14, 0xe8, 0x3f, 0xe8, 0x4f, 0xe8, 0xbe,
+	0xab, 0xfe, 0x80, 0xfe, 0x8a, 0xe2, 0x9e, 0x4b, 0x52, 0x14, 0x45, 0x3a, 0x71, 0x50, 0x20, 0x2b,
+	0x9b, 0xe7, 0x9c, 0x7b, 0x1e, 0xdf, 0x79, 0xdc, 0x73, 0x05, 0x7a, 0xe0, 0x78, 0x97, 0x21, 0x0b,
+	0xae, 0x59, 0xf0, 0x74, 0x19, 0xf8, 0x91, 0x4f, 0x65, 0xfc, 0xb3, 0xff, 0x87, 0x16, 0x28, 0xa7,
+	0x8e, 0x77, 0xe9, 0x7a, 0xe7, 0xa6, 0x0c, 0xd2, 0xd8, 0x5d, 0x98, 0xef, 0x80, 0x6c, 0xb3, 0x68,
+	0x30, 0xa7, 0xbb, 0xf1, 0x3f, 0x06, 0x69, 0x91, 0x76, 0xd5, 0xfc, 0x77, 0x05, 0xea, 0xdd, 0x80,
+	0x39, 0x11, 0xb3, 0x59, 0x94, 0x63, 0xd2, 0x0f, 0x40, 0x9e, 0x04, 0x73, 0x16, 0x18, 0x95, 0x16,
+	0x69, 0x37, 0x0e, 0x1f, 0x09, 0x2b, 0x4f, 0x63, 0xd5, 0x4f, 0x91, 0xc7, 0xcf, 0xbc, 0x5c, 0xf8,
+	0x4e, 0x64, 0x48, 0x2d, 0xd2, 0x56, 0xe9, 0x0e, 0x54, 0xc7, 0xce, 0x15, 0x33, 0xaa, 0x2d, 0xd2,
+	0xae, 0x73, 0xe6, 0xe4, 0xf7, 0x1e, 0x0b, 0x0c, 0x19, 0x3f, 0x9b, 0xa0, 0x8c, 0x9c, 0x1b, 0xdb,
+	0xfd, 0x9a, 0x19, 0xb5, 0x16, 0x69, 0xcb, 0x54, 0x03, 0x69, 0x3a, 0x1d, 0x1a, 0x4a, 0x8b, 0xb4,
+	0x25, 0x7a, 0x04, 0xb5, 0xa1, 0xf3, 0x96, 0x2d, 0x42, 0x43, 0x6d, 0x49, 0x6d, 0xed, 0xf0, 0xc3,
+	0x9c, 0xbd, 0xd4, 0xcf, 0xa7, 0x42, 0xac, 0xef, 0x45, 0xc1, 0x2d, 0xfd, 0x08, 0x6a, 0x5f, 0xb0,
+	0xc0, 0xf5, 0xe7, 0x46, 0x1d, 0xbd, 0x7c, 0x9c, 0x3b, 0x25, 0x98, 0x54, 0x07, 0x75, 0xea, 0x5e,
+	0xb1, 0xaf, 0x7d, 0x8f, 0x19, 0x80, 0xce, 0xec, 0x40, 0xf5, 0x73, 0xc6, 0x96, 0x86, 0x86, 0x9e,
+	0xe8, 0xa0, 0xf6, 0x6f, 0x96, 0x6e, 0xc0, 0xac, 0xc8, 0xd8, 0x41, 0x77, 0x9a, 0xa0, 0x0c, 0xe6,
+	0x0b, 0xc6, 0xfd, 0xdb, 0xe5, 0x04, 0xf3, 0xa7, 0xa0, 0x65, 0x0d, 0x6b, 0x20, 0x5d, 0xb2, 0x5b,
+	0x83, 0x24, 0x81, 0x5e, 0x3b, 0x8b, 0x15, 0x43, 0xa8, 0xea, 0x9f, 0x55, 0x7e, 0x41, 0xcc, 0x9f,
+	0x40, 0xdd, 0x66, 0x11, 0x2a, 0xbd, 0xcd, 0x23, 0x9b, 0xb5, 0x56, 0x41, 0xe5, 0x7f, 0x91, 0x40,
+	0xe1, 0x12, 0xde, 0x99, 0xff, 0x03, 0xa7, 0xe1, 0x30, 0x97, 0x86, 0xfd, 0x9c, 0xbd, 0xd8, 0xcb,
+	0x8d, 0x24, 0xec, 0x25, 0x55, 0x34, 0xb7, 0x22, 0xcc, 0x83, 0xc4, 0x6d, 0x76, 0xfd, 0x95, 0x17,
+	0x21, 0xda, 0x72, 0x26, 0x4d, 0xda, 0x77, 0x4d, 0xd3, 0xce, 0x46, 0x9a, 0x76, 0x51, 0xcd, 0x43,
+	0xd0, 0x84, 0xa4, 0x1d, 0x39, 0x41, 0x64, 0x34, 0xd0, 0x54, 0x16, 0xcd, 0x66, 0x3e, 0x77, 0x7a,
+	0x42, 0xe8, 0xb1, 0xc0, 0xbd, 0x66, 0x73, 0x63, 0x8f, 0x03, 0x74, 0xdf, 0x64, 0x7e, 0x03, 0xea,
+	0xd0, 0x0d, 0x23, 0x9b, 0x45, 0xe1, 0x1a, 0x4d, 0x21, 0xfd, 0x49, 0x8a, 0x57, 0x05, 0xf1, 0xfa,
+	0x20, 0x17, 0x59, 0x72, 0x2e, 0x0b, 0xd8, 0x7d, 0xcd, 0x1f, 0x80, 0x1a, 0xc3, 0x1e, 0xd2, 0x0f,
+	0xa1, 0xca, 0xd5, 0x19, 0x04, 0xad, 0xbd, 0x53, 0x9c, 0x1d, 0xb3, 0x07, 0x7b, 0x3d, 0xb6, 0x60,
+	0x11, 0xfb, 0x32, 0x64, 0xc1, 0x29, 0xfb, 0x6a, 0xc5, 0xc2, 0xad, 0xfe, 0x6e, 0x40, 0x8d, 0x73,
+	0x07, 0x73, 0xa3, 0x92, 0xf4, 0x80, 0xf8, 0x3e, 0x3e, 0xc2, 0x32, 0x92, 0xcc, 0xff, 0x10, 0xa8,
+	0x75, 0x2f, 0x1c, 0xef, 0x9c, 0x65, 0x84, 0x09, 0x0a, 0x73, 0x5d, 0x33, 0x3f, 0x60, 0x46, 0x25,
+	0xfd, 0x44, 0xd5, 0x12, 0xaa, 0xfe, 0x11, 0x54, 0x47, 0xfe, 0x5c, 0xd4, 0x5f, 0xe3, 0xf0, 0x61,
+	0xce, 0x49, 0xce, 0xe2, 0x31, 0xdb, 0xec, 0x2b, 0x43, 0x4e, 0x1a, 0x22, 0x35, 0x5d, 0x4b, 0x32,
+	0x86, 0xfa, 0x8f, 0x8f, 0xe2, 0xba, 0xe4, 0x45, 0xea, 0x32, 0x43, 0xc5, 0x0f, 0x0a, 0x80, 0x5c,
+	0x51, 0xf3, 0xbc, 0xe2, 0xc8, 0xba, 0x05, 0x00, 0x5b, 0x20, 0x6d, 0x1b, 0xad, 0xbc, 0x6d, 0xcc,
+	0x03, 0xd8, 0x11, 0xf1, 0x9d, 0xb2, 0x70, 0xb5, 0x88, 0xb8, 0x55, 0xf1, 0x2d, 0xc2, 0x54, 0x39,
+	0x61, 0xe2, 0x75, 0x7c, 0x27, 0x10, 0x20, 0xa9, 0xe6, 0x11, 0x48, 0xd6, 0xec, 0x32, 0xf1, 0x5e,
+	0x00, 0xd9, 0x04, 0xc5, 0x5a, 0x2e, 0x17, 0x2e, 0x13, 0x42, 0x52, 0x56, 0x8d, 0x00, 0xf2, 0x53,
+	0xd0, 0x04, 0xa1, 0xe3, 0x44, 0xb3, 0x0b, 0xfa, 0x71, 0xc2, 0x4f, 0xd2, 0x98, 0x6f, 0x07, 0xc1,
+	0x35, 0x9f, 0xc3, 0x5e, 0xe6, 0x58, 0xec, 0xe3, 0xc3, 0xac, 0x8f, 0x52, 0x5b, 0xed, 0x54, 0x74,
+	0x42, 0xf7, 0x40, 0xe6, 0x67, 0x45, 0x11, 0xca, 0x9c, 0x64, 0xfe, 0x95, 0x40, 0x7d, 0xe0, 0xcd,
+	0x02, 0x76, 0xc5, 0xbc, 0xa8, 0x28, 0x7f, 0x3d, 0xb6, 0x88, 0x9c, 0xe2, 0xfc, 0x65, 0xf3, 0x51,
+	0x5d, 0x77, 0xd0, 0x22, 0x72, 0x8e, 0x8f, 0x0c, 0x39, 0x49, 0x01, 0x12, 0x04, 0xe6, 0xb5, 0xcd,
+	0x14, 0x28, 0x9b, 0x29, 0x50, 0xef, 0x48, 0xc1, 0x50, 0x98, 0xe2, 0x44, 0xde, 0xec, 0xfc, 0x6f,
+	0x71, 0x89, 0x65, 0x2a, 0x42, 0x2a, 0x28, 0x02, 0xee, 0x26, 0x31, 0x67, 0x88, 0xc3, 0x39, 0xa3,
+	0x75, 0x20, 0x56, 0xac, 0xa7, 0x0e, 0xa4, 0x53, 0x1c, 0x26, 0x05, 0x38, 0x61, 0x1e, 0x0b, 0x9c,
+	0xc8, 0xf5, 0x3d, 0xd4, 0x20, 0xf3, 0xd2, 0x9d, 0xba, 0x2c, 0x34, 0xe4, 0xc2, 0xd2, 0xe5, 0x2c,
+	0xf3, 0x6f, 0x04, 0x54, 0x4e, 0xe0, 0xad, 0xcd, 0xd3, 0x21, 0xa0, 0x12, 0xb9, 0x44, 0xec, 0x29,
+	0x85, 0x1a, 0xba, 0x96, 0xc9, 0x07, 0x7d, 0x0c, 0xf5, 0x58, 0x10, 0x23, 0x90, 0xda, 0x12, 0x92,
+	0x1f, 0x81, 0x2a, 0x44, 0x11, 0xea, 0x84, 0xfa, 0x04, 0x34, 0x41, 0x15, 0xc1, 0xc9, 0x2d, 0xa9,
+	0x4d, 0x36, 0x13, 0x5d, 0x4b, 0x15, 0xbf, 0x07, 0x4d, 0x24, 0xbd, 0x0c, 0x9c, 0x19, 0x0f, 0xc4,
+	0x59, 0x18, 0x4a, 0x22, 0x6f, 0xde, 0x82, 0xcc, 0xad, 0x86, 0xc5, 0x7e, 0xa6, 0x78, 0x54, 0x10,
+	0x8f, 0x12, 0x17, 0xbf, 0x27, 0x4c, 0xdf, 0x88, 0xcc, 0x22, 0x4a, 0xa9, 0xdb, 0x77, 0x63, 0x94,
+	0x05, 0x43, 0x2a, 0x03, 0xa3, 0x9a, 0x82, 0x51, 0x10, 0x79, 0x8a, 0x94, 0xf9, 0x27, 0x02, 0x60,
+	0x05, 0xfe, 0xca, 0x9b, 0x73, 0x2f, 0xbe, 0x6d, 0xf8, 0x35, 0xa0, 0xd6, 0x61, 0x67, 0xbc, 0xda,
+	0xa4, 0xa4, 0x52, 0xac, 0xb3, 0x88, 0x05, 0x71, 0xb8, 0xd9, 0x86, 0x48, 0xeb, 0x3f, 0x03, 0x4a,
+	0x6d, 0x03, 0x14, 0xa5, 0x1c, 0x94, 0xbf, 0xa7, 0x5e, 0xdd, 0xaf, 0x7a, 0x52, 0x00, 0xa5, 0xe2,
+	0x82, 0xaa, 0x16, 0x16, 0x94, 0x5c, 0x86, 0x61, 0xed, 0x2e, 0x0c, 0xd7, 0xd5, 0xf3, 0x2f, 0x12,
+	0xf7, 0x98, 0x68, 0xaa, 0x1c, 0x86, 0x1a, 0x48, 0x23, 0xd7, 0x8b, 0x01, 0xe4, 0x1f, 0xce, 0x4d,
+	0x8c, 0x5e, 0x03, 0x6a, 0x93, 0xb3, 0xb3, 0x90, 0x45, 0x31, 0x7c, 0xbb, 0x20, 0x0f, 0xdd, 0x2b,
+	0x37, 0x32, 0xe4, 0xe4, 0x73, 0xe4, 0x7a, 0xe9, 0xac, 0xe7, 0x9f, 0xce, 0x4d, 0x3a, 0xe9, 0x75,
+	0x50, 0x47, 0xae, 0x27, 0xfc, 0x54, 0x71, 0xae, 0x70, 0x8a, 0x73, 0x93, 0x1d, 0xf6, 0x9b, 0xe8,
+	0xc3, 0x06, 0xfa, 0x5a, 0x39, 0xfa, 0xff, 0x24, 0x50, 0xc7, 0x78, 0xee, 0x0b, 0x7e, 0x1d, 0x17,
+	0x0e, 0x1c, 0x4e, 0x22, 0xc2, 0xff, 0x0f, 0xf8, 0x69, 0x56, 0x95, 0xbb, 0xba, 0x59, 0x4d, 0xf3,
+	0xf1, 0xc7, 0x24, 0x1f, 0xb8, 0x5b, 0x7d, 0xf7, 0x7c, 0xa4, 0x80, 0x57, 0x37, 0x01, 0x97, 0xb7,
+	0x00, 0xaf, 0x6d, 0x01, 0xae, 0x14, 0x00, 0xce, 0xd3, 0x22, 0xf3, 0x57, 0x45, 0xea, 0x07, 0xfe,
+	0x23, 0x06, 0xae, 0xf9, 0x0f, 0x02, 0x75, 0xeb, 0xfc, 0x3c, 0x60, 0xe7, 0x4e, 0x84, 0x9b, 0x43,
+	0x8f, 0x85, 0x6b, 0x2f, 0x1f, 0x43, 0xdd, 0xf6, 0x57, 0xc1, 0x8c, 0x0d, 0xe6, 0x02, 0xe3, 0x2a,
+	0xc6, 0xfd, 0x10, 0x94, 0x57, 0xcc, 0x3d, 0xbf, 0x88, 0x44, 0x89, 0x0b, 0x7c, 0x7e, 0x06, 0x5a,
+	0xa2, 0x28, 0x19, 0x3d, 0x8d, 0x43, 0x33, 0x97, 0xd9, 0x8c, 0x04, 0xcf, 0xd4, 0xc0, 0x8b, 0x58,
+	0x10, 0xb2, 0x99, 0x28, 0x36, 0x95, 0x7b, 0xde, 0xf5, 0xbd, 0xc8, 0xf5, 0x56, 0xfe, 0x2a, 0xc4,
+	0xf8, 0x54, 0xee, 0xf0, 0x49, 0xe0, 0xaf, 0x96, 0xe2, 0xa2, 0x32, 0x2d, 0x80, 0x11, 0xbb, 0x7a,
+	0xcb, 0x82, 0xf0, 0xc2, 0x5d, 0xe6, 0x51, 0xcd, 0x54, 0x49, 0x25, 0xcd, 0x68, 0x13, 0x14, 0x54,
+	0x30, 0x48, 0x6e, 0xf8, 0x1f, 0xc7, 0x1a, 0xf3, 0xa7, 0x33, 0x82, 0x62, 0xd3, 0x7f, 0x1f, 0x94,
+	0xd8, 0x56, 0xbe, 0xfe, 0x50, 0xb3, 0xf9, 0x11, 0x34, 0x6d, 0xcf, 0x59, 0x86, 0x17, 0x7e, 0x94,
+	0xec, 0x6d, 0xbc, 0x24, 0x59, 0x94, 0x88, 0x21, 0x5c, 0xe6, 0x63, 0x90, 0xbb, 0x17, 0x2b, 0x71,
+	0x67, 0xf6, 0x9c, 0xc8, 0x41, 0x73, 0x3b, 0xe6, 0xc7, 0xa0, 0xbe, 0xe2, 0xbb, 0xc2, 0xd4, 0x5f,
+	0x16, 0x54, 0xc7, 0xd4, 0x5f, 0x8a, 0xea, 0x30, 0x4f, 0x00, 0x50, 0x4e, 0xdc, 0x0d, 0x77, 0x47,
+	0x7c, 0xd7, 0xf5, 0x65, 0xfe, 0x99, 0x08, 0x7a, 0xff, 0xba, 0x68, 0xcb, 0x48, 0x2e, 0xf4, 0xf4,
+	0x06, 0x9f, 0x2c, 0xe6, 0x99, 0x26, 0x4a, 0x6f, 0x78, 0x31, 0x25, 0x00, 0x2a, 0x9d, 0x5b, 0x43,
+	0xde, 0x1a, 0xb8, 0x25, 0x1b, 0xe1, 0x0e, 0x54, 0x3b, 0xb7, 0xc7, 0x47, 0xe5, 0x2b, 0xe1, 0xfe,
+	0x33, 0xb1, 0x86, 0x52, 0x80, 0x9a, 0x35, 0x7c, 0x65, 0xbd, 0xb1, 0xf5, 0x07, 0x54, 0x03, 0xe5,
+	0xe4, 0xb4, 0x6f, 0x4d, 0xfb, 0xa7, 0x3a, 0xa1, 0x2a, 0x54, 0x87, 0x7d, 0xdb, 0xd6, 0x2b, 0xb4,
+	0x06, 0x95, 0xf1, 0x6b, 0x5d, 0xe2, 0x7f, 0x5f, 0xbf, 0xd6, 0xab, 0xfb, 0x66, 0xbc, 0xbb, 0x70,
+	0x91, 0x5e, 0xdf, 0xee, 0xea, 0x0f, 0xa8, 0x02, 0x92, 0x65, 0x77, 0x75, 0xb2, 0x7f, 0x9c, 0x3c,
+	0x66, 0x38, 0x73, 0x3c, 0x19, 0xf7, 0xf5, 0x07, 0xb4, 0x0e, 0x72, 0xcf, 0x1a, 0x0c, 0xdf, 0xe8,
+	0x84, 0x5b, 0x7b, 0xd5, 0xef, 0x7f, 0x3e, 0x7c, 0xa3, 0x57, 0xb8, 0xb5, 0xd1, 0x64, 0x3c, 0xfd,
+	0xcd, 0xf0, 0x8d, 0x2e, 0xed, 0xb7, 0x37, 0xaa, 0x99, 0xeb, 0xb3, 0xbf, 0x1c, 0x09, 0xc5, 0xa3,
+	0xc1, 0x58, 0x27, 0xf8, 0x8f, 0xf5, 0x5a, 0xaf, 0xec, 0xbf, 0x10, 0xa3, 0x8c, 0x1f, 0x9f, 0x9c,
+	0xf6, 0x06, 0x63, 0x6b, 0xa8, 0x3f, 0xa0, 0x4d, 0xd0, 0xba, 0x93, 0xd1, 0x17, 0xfd, 0xe9, 0x60,
+	0x3a, 0x98, 0x70, 0x71, 0x6e, 0xb3, 0x3f, 0xb6, 0xfb, 0x7a, 0x85, 0x36, 0x00, 0x5e, 0x9e, 0x5a,
+	0x5d, 0xce, 0xb0, 0x86, 0xba, 0x74, 0xf8, 0x5f, 0x0d, 0x1a, 0x71, 0x7f, 0xd8, 0x2c, 0xb8, 0x76,
+	0x67, 0x8c, 0xfe, 0x1a, 0x80, 0x53, 0xe2, 0x7d, 0xbe, 0x64, 0xe3, 0x7c, 0xaf, 0x90, 0x1c, 0x6f,
+	0x9e, 0x1d, 0xd8, 0xb3, 0xa3, 0x80, 0x39, 0x57, 0x6b, 0x3d, 0x61, 0x99, 0x22, 0x9a, 0x6f, 0xd2,
+	0xd9, 0x65, 0x9b, 0x1c, 0x10, 0x3a, 0x11, 0xe3, 0x2d, 0xbb, 0x0d, 0x9b, 0x85, 0x1a, 0x90, 0x67,
+	0xb6, 0xca, 0x79, 0xb1, 0x53, 0x5d, 0x68, 0xa4, 0x5b, 0x2e, 0x16, 0x00, 0x35, 0x72, 0x67, 0x52,
+	0xb6, 0xf9, 0x24, 0xc7, 0x49, 0x17, 0xcf, 0x67, 0xd9, 0x9f, 0x41, 0x8c, 0xb2, 0x1f, 0x1e, 0xb6,
+	0x82, 0x1a, 0xbb, 0x0b, 0xfa, 0x1c, 0xb4, 0x1e, 0x0b, 0x67, 0x81, 0xfb, 0x16, 0x0f, 0x3f, 0x2a,
+	0x78, 0x90, 0xcd, 0xcd, 0x92, 0x67, 0x1a, 0xfd, 0x65, 0xe6, 0x5d, 0xf9, 0xa4, 0xe4, 0xe1, 0x68,
+	0x3e, 0x29, 0x3e, 0x1c, 0xd2, 0x4f, 0xa1, 0x2e, 0x1e, 0x79, 0xe5, 0x86, 0x8b, 0x3c, 0x7e, 0x96,
+	0xfd, 0x65, 0xc2, 0xd8, 0x3e, 0x26, 0x38, 0x85, 0x47, 0x3b, 0x00, 0xeb, 0x67, 0x25, 0xcd, 0x27,
+	0x67, 0xeb, 0xc5, 0x59, 0xa8, 0xe3, 0x05, 0x34, 0x7e, 0xb7, 0x62, 0xc1, 0x2d, 0xa7, 0x89, 0xb5,
+	0x22, 0xef, 0x3a, 0x52, 0xb7, 0xc2, 0x4e, 0x37, 0xee, 0xe7, 0x00, 0xa8, 0x40, 0xcc, 0xae, 0x47,
+	0x05, 0x39, 0x0d, 0x0b, 0x33, 0x8d, 0x87, 0x4f, 0xa0, 0x89, 0x87, 0x33, 0x9b, 0xe1, 0xbb, 0xf9,
+	0x52, 0x4d, 0x59, 0x66, 0x31, 0x0b, 0x15, 0xbd, 0x8c, 0x15, 0x65, 0xd6, 0xa3, 0xbc, 0xf4, 0x9a,
+	0x65, 0x1a, 0x45, 0x2c, 0xd4, 0xf3, 0xab, 0xcc, 0xc4, 0xce, 0x7b, 0x9d, 0x30, 0x4a, 0xb1, 0x38,
+	0x20, 0xb4, 0xbb, 0x31, 0xc9, 0xdf, 0x2d, 0xd2, 0x20, 0x20, 0x31, 0x0a, 0x20, 0xc1, 0xa9, 0x7d,
+	0x40, 0x68, 0x07, 0x9a, 0x78, 0x81, 0x7f, 0x5b, 0x30, 0x28, 0x64, 0xe6, 0x21, 0x47, 0x2a, 0x7d,
+	0x01, 0xbb, 0xe9, 0xa5, 0x8f, 0x05, 0x6d, 0x94, 0xdc, 0xd3, 0xac, 0x44, 0xc1, 0x67, 0x50, 0xff,
+	0xad, 0xef, 0x7a, 0xe2, 0x1a, 0xcd, 0x9b, 0x5f, 0xdf, 0xcf, 0x25, 0x5d, 0x08, 0x43, 0xe6, 0x5c,
+	0xb3, 0xef, 0x75, 0xd8, 0x82, 0x3d, 0x4c, 0x25, 0x1e, 0x8e, 0x65, 0xb7, 0xea, 0x0a, 0x99, 0x5b,
+	0x8d, 0x9c, 0x48, 0x77, 0x40, 0x4d, 0x6e, 0x6d, 0xfa, 0x7e, 0x1e, 0xb9, 0xcd, 0xeb, 0x7c, 0x3b,
+	0x7a, 0x7e, 0x8f, 0x1f, 0x10, 0xfa, 0x73, 0x50, 0x4e, 0x59, 0x18, 0xf1, 0x11, 0x56, 0x28, 0x52,
+	0x0c, 0x5b, 0x9b, 0xbc, 0xad, 0x21, 0xf9, 0x93, 0xff, 0x0d, 0x00, 0x8f, 0x88, 0xff, 0x78, 0x12,
+	0x16, 0x00, 0x00,
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"math"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"gopkg.in/vmihailenco/msgpack.v2"
@@ -22,35 +24,194 @@ const (
 	RBTREE
 )
 
-// a ranking set
+// update modes, same values as Ranking_Mode
+const (
+	UPDATE_ALWAYS  = iota // always set the score
+	UPDATE_GREATER        // only if new score is greater than the stored one, or user not exists
+	UPDATE_LESS           // only if new score is less than the stored one, or user not exists
+	UPDATE_NX             // only if user not exists
+	UPDATE_XX             // only if user exists
+)
+
+// sort orders, same values as Ranking_Order
+const (
+	ORDER_DESC = iota // higher score ranks first
+	ORDER_ASC         // lower score ranks first
+)
+
+// tie semantics of ranks, same values as Ranking_Ties.
+// users tie if both score and tie are equal.
+const (
+	TIES_ORDINAL     = iota // ranked by id, "1234"
+	TIES_COMPETITION        // same rank, gaps after, "1224"
+	TIES_DENSE              // same rank, no gaps, "1223"
+	TIES_FRACTIONAL         // mean of the ordinal ranks, "1 2.5 2.5 4"
+)
+
+// a ranking set, users are ranked by score descending(or ascending by Order),
+// then tie ascending, then id ascending.
+// the underlying storages always rank descending, ascending sets store the
+// bitwise complement of scores there, see key().
 type RankSet struct {
-	R    dos.Tree        // rbtree
-	S    ss.SortedSet    // sorted-set
-	M    map[int32]int32 // ID  => SCORE
-	Type int
+	R         dos.Tree        // rbtree
+	S         ss.SortedSet    // sorted-set
+	M         map[int64]int64 // ID  => SCORE
+	T         map[int64]int64 // ID  => TIE, zero ties are omitted
+	U         map[int64]int64 // ID  => LAST UPDATE(unix seconds), tracked if Meta.Idle > 0
+	G         map[int64]int64 // ID  => GROUP, kept regardless of scores
+	Float     bool            // scores are float64 mapped by float_score
+	Order     int             // ORDER_DESC or ORDER_ASC
+	Meta      SetMeta
+	Type      int
+	groups    map[int64]map[int64]bool // GROUP => IDS, index of G
+	watchers  map[*Watcher]bool
+	observers map[*Observer]bool
+	dirty     map[int64]bool // users changed since the last dump
+	retired   bool           // replaced, rotated or removed from the server
+	end       int64          // end of the period, cached by due
 	sync.RWMutex
 }
 
+// persistent form of a rankset
+type rankset_dump struct {
+	M     map[int64]int64 `msgpack:"m"`
+	T     map[int64]int64 `msgpack:"t"`
+	U     map[int64]int64 `msgpack:"u"`
+	G     map[int64]int64 `msgpack:"g"`
+	Float bool            `msgpack:"f"`
+	Order int             `msgpack:"o"`
+	Meta  SetMeta         `msgpack:"meta"`
+}
+
+// persistent form of a set without users
+type rankset_info struct {
+	Float bool    `msgpack:"f"`
+	Order int     `msgpack:"o"`
+	Meta  SetMeta `msgpack:"meta"`
+}
+
+// persistent form of a user, users may have a group only
+type rank_entry struct {
+	Score  int64 `msgpack:"s"`
+	Scored bool  `msgpack:"ok"`
+	Tie    int64 `msgpack:"t,omitempty"`
+	Update int64 `msgpack:"u,omitempty"`
+	Group  int64 `msgpack:"g,omitempty"`
+}
+
+// descriptive metadata of a set, fixed at creation
+type SetMeta struct {
+	Name      string            `msgpack:"name"`
+	Owner     string            `msgpack:"owner"`
+	MaxSize   int32             `msgpack:"maxsize"` // lowest entries are evicted beyond this, 0 for unlimited
+	TTL       int64             `msgpack:"ttl"`     // seconds, 0 for forever
+	Labels    map[string]string `msgpack:"labels"`
+	CreatedAt int64             `msgpack:"created"` // unix seconds
+	Period    int               `msgpack:"period"`  // PERIOD_XXX
+	Timezone  string            `msgpack:"tz"`      // location of period boundaries
+	Keep      int32             `msgpack:"keep"`    // past generations kept
+	Start     int64             `msgpack:"start"`   // start of the generation, unix seconds
+	ExpireAt  int64             `msgpack:"expire"`  // unix seconds, 0 for never
+	Idle      int64             `msgpack:"idle"`    // seconds before an inactive user is removed, 0 for never
+	Derived   *Aggregation      `msgpack:"derived"` // continuously aggregated from other sets
+}
+
+// a watcher gets notified with the changed id when the ranks within top-N
+// have changed, notifications are coalesced, only the latest id is kept.
+type Watcher struct {
+	C    chan int64
+	Done chan struct{} // closed once the set is retired
+	top  int           // 0 for any change
+}
+
+// an observer is called with every changed id, under the write lock of
+// the set, so it must neither block nor touch other sets.
+type Observer struct {
+	f func(id int64)
+}
+
 func NewRankSet() *RankSet {
 	r := new(RankSet)
-	r.M = make(map[int32]int32)
+	r.M = make(map[int64]int64)
+	r.T = make(map[int64]int64)
+	r.U = make(map[int64]int64)
+	r.G = make(map[int64]int64)
+	r.groups = make(map[int64]map[int64]bool)
+	r.dirty = make(map[int64]bool)
 	r.Type = SORTEDSET // default in sortedset
 	return r
 }
 
+// order-preserving mapping of float64 scores into int64 scores
+func float_score(f float64) int64 {
+	s := int64(math.Float64bits(f))
+	if s < 0 { // negative floats are ordered reversely
+		s ^= math.MaxInt64
+	}
+	return s
+}
+
+func score_float(s int64) float64 {
+	if s < 0 {
+		s ^= math.MaxInt64
+	}
+	return math.Float64frombits(uint64(s))
+}
+
+// storage key of a score, reversing the order for ascending sets,
+// the complement is its own inverse, so it also maps keys back to scores.
+func (r *RankSet) key(score int64) int64 {
+	if r.Order == ORDER_ASC {
+		return ^score
+	}
+	return score
+}
+
+// map storage keys back to scores in place
+func (r *RankSet) scores(keys []int64) []int64 {
+	if r.Order == ORDER_ASC {
+		for k := range keys {
+			keys[k] = ^keys[k]
+		}
+	}
+	return keys
+}
+
+// storage key range of the score range [min,max]
+func (r *RankSet) key_range(min, max int64) (int64, int64) {
+	if r.Order == ORDER_ASC {
+		return ^max, ^min
+	}
+	return min, max
+}
+
+// check if the set has expired at now(unix seconds)
+func (r *RankSet) Expired(now int64) bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.Meta.ExpireAt > 0 && now >= r.Meta.ExpireAt
+}
+
+// set the expiry in unix seconds, 0 for never
+func (r *RankSet) SetExpiry(at int64) {
+	r.Lock()
+	defer r.Unlock()
+	r.Meta.ExpireAt = at
+}
+
 // toggle storage base on Type
 func (r *RankSet) toggle() {
 	switch r.Type {
 	case SORTEDSET:
 		for k, v := range r.M {
-			r.R.Insert(v, k)
+			r.R.Insert(r.key(v), r.T[k], k)
 		}
 		r.S.Clear()
 		r.Type = RBTREE
 		log.Debugf("convert sortedset to rbtree %v", len(r.M))
 	case RBTREE:
 		for k, v := range r.M {
-			r.S.Insert(v, k)
+			r.S.Insert(k, r.key(v), r.T[k])
 		}
 		r.R.Clear()
 		r.Type = SORTEDSET
@@ -58,11 +219,159 @@ func (r *RankSet) toggle() {
 	}
 }
 
-func (r *RankSet) Update(id, newscore int32) {
+// update the score & tie of a user according to mode, modes compare
+// scores only, returns whether the stored score or tie has changed,
+// whether the user is on the board afterwards, and whether only the
+// activity of the user has been refreshed.
+func (r *RankSet) Update(id, newscore, tie int64, mode int) (changed bool, onboard bool, touched bool) {
 	r.Lock()
 	defer r.Unlock()
+	changed, touched = r.update_mode(id, newscore, tie, mode)
+	_, onboard = r.M[id]
+	return
+}
+
+// apply a batch of updates under one lock, ranks are taken after
+// all updates have been applied, touched is set if any update only
+// refreshed the activity of a user.
+func (r *RankSet) UpdateBatch(ids, scores, ties []int64, modes []int) (changed []bool, ranks []int32, touched bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	changed = make([]bool, len(ids))
+	for k := range ids {
+		var t bool
+		changed[k], t = r.update_mode(ids[k], scores[k], ties[k], modes[k])
+		touched = touched || t
+	}
+
+	ranks = make([]int32, len(ids))
+	for k, id := range ids {
+		ranks[k] = int32(r.rank(id))
+	}
+	return
+}
 
+func (r *RankSet) update_mode(id, newscore, tie int64, mode int) (changed bool, touched bool) {
+	if changed = r.accept(id, newscore, tie, mode); changed || r.Meta.Idle <= 0 {
+		return
+	}
+	if _, ok := r.M[id]; ok { // any submission keeps a user active
+		r.touch(id)
+		r.observe(id)
+		touched = true
+	}
+	return
+}
+
+// apply an update if the mode accepts it
+func (r *RankSet) accept(id, newscore, tie int64, mode int) bool {
 	oldscore, ok := r.M[id]
+	switch mode {
+	case UPDATE_GREATER:
+		if ok && newscore <= oldscore {
+			return false
+		}
+	case UPDATE_LESS:
+		if ok && newscore >= oldscore {
+			return false
+		}
+	case UPDATE_NX:
+		if ok {
+			return false
+		}
+	case UPDATE_XX:
+		if !ok {
+			return false
+		}
+	}
+
+	if ok && newscore == oldscore && tie == r.T[id] {
+		return false
+	}
+	if !ok && !r.make_room(id, newscore, tie) {
+		return false
+	}
+	r.update(id, newscore, tie)
+	return true
+}
+
+// check if a new user makes the board of a capped set, the lowest entry
+// is evicted to make room.
+func (r *RankSet) make_room(id, score, tie int64) bool {
+	n := len(r.M)
+	if r.Meta.MaxSize <= 0 || n < int(r.Meta.MaxSize) {
+		return true
+	}
+
+	var ids, keys []int64
+	switch r.Type {
+	case SORTEDSET:
+		ids, keys = r.S.GetList(n, n)
+	case RBTREE:
+		ids, keys = r.R.GetList(n, n)
+	}
+
+	// must rank before the lowest one
+	lowest, key := ids[0], r.key(score)
+	if key < keys[0] || key == keys[0] && (tie > r.T[lowest] || tie == r.T[lowest] && id > lowest) {
+		return false
+	}
+	r.delete(lowest)
+	return true
+}
+
+// add delta to the score of a user, saturated at int64 bounds,
+// a new user starts from 0, newrank is -1 if the user missed a capped board.
+func (r *RankSet) Increment(id, delta int64) (newscore int64, newrank int32) {
+	r.Lock()
+	defer r.Unlock()
+
+	oldscore := r.M[id]
+	newscore = oldscore + delta
+	if delta > 0 && newscore < oldscore {
+		newscore = math.MaxInt64
+	} else if delta < 0 && newscore > oldscore {
+		newscore = math.MinInt64
+	}
+
+	if _, ok := r.M[id]; !ok && !r.make_room(id, newscore, 0) {
+		return newscore, -1
+	}
+	r.update(id, newscore, r.T[id])
+	return newscore, int32(r.rank(id))
+}
+
+// add delta to the float score of a user, a new user starts from 0.
+// nothing changes and ok is false if the new score is not finite.
+func (r *RankSet) IncrementFloat(id int64, delta float64) (newscore float64, newrank int32, ok bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	newscore = delta
+	oldscore, exists := r.M[id]
+	if exists {
+		newscore += score_float(oldscore)
+	}
+	if math.IsNaN(newscore) || math.IsInf(newscore, 0) {
+		return newscore, -1, false
+	}
+	if !exists && !r.make_room(id, float_score(newscore), 0) {
+		return newscore, -1, true
+	}
+
+	r.update(id, float_score(newscore), r.T[id])
+	return newscore, int32(r.rank(id)), true
+}
+
+func (r *RankSet) update(id, newscore, tie int64) {
+	oldscore, ok := r.M[id]
+	oldtie := r.T[id]
+	lo := -1 // the highest rank affected
+	if ok && len(r.watchers) > 0 {
+		lo = r.rank(id)
+	}
+
 	if !ok { // new element
 		if r.Type == SORTEDSET && len(r.M) > UPPER_THRESHOLD { // do convert
 			r.toggle()
@@ -70,27 +379,85 @@ func (r *RankSet) Update(id, newscore int32) {
 
 		switch r.Type {
 		case SORTEDSET:
-			r.S.Insert(id, newscore)
+			r.S.Insert(id, r.key(newscore), tie)
 		case RBTREE:
-			r.R.Insert(newscore, id)
+			r.R.Insert(r.key(newscore), tie, id)
 		}
 	} else {
 		switch r.Type {
 		case SORTEDSET:
-			r.S.Update(id, newscore)
+			r.S.Update(id, r.key(newscore), tie)
 		case RBTREE:
-			_, n := r.R.Locate(oldscore, id)
+			_, n := r.R.Locate(r.key(oldscore), oldtie, id)
 			r.R.Delete(id, n)
-			r.R.Insert(newscore, id)
+			r.R.Insert(r.key(newscore), tie, id)
 		}
 	}
 	r.M[id] = newscore
+	if tie != 0 {
+		r.T[id] = tie
+	} else {
+		delete(r.T, id)
+	}
+	r.touch(id)
+
+	if len(r.watchers) > 0 {
+		if rank := r.rank(id); lo == -1 || rank < lo {
+			lo = rank
+		}
+		r.notify(id, lo)
+	}
+	r.observe(id)
+}
+
+// record the activity of a user
+func (r *RankSet) touch(id int64) {
+	if r.Meta.Idle > 0 {
+		r.U[id] = time.Now().Unix()
+		r.dirty[id] = true
+	}
+}
+
+// set the last activity of a user, for replaying
+func (r *RankSet) SetActivity(id, at int64) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.M[id]; ok && at != 0 && r.Meta.Idle > 0 {
+		r.U[id] = at
+	}
+}
+
+// delete at most n users not updated since before(unix seconds),
+// returns the number of deleted users.
+func (r *RankSet) DeleteInactive(before int64, n int) (count int) {
+	r.Lock()
+	defer r.Unlock()
+	for id, t := range r.U {
+		if count >= n {
+			break
+		}
+		if t < before {
+			r.delete(id)
+			count++
+		}
+	}
 	return
 }
 
-func (r *RankSet) Delete(userid int32) {
+func (r *RankSet) Delete(userid int64) {
 	r.Lock()
 	defer r.Unlock()
+	r.delete(userid)
+}
+
+func (r *RankSet) delete(userid int64) {
+	if _, ok := r.M[userid]; !ok {
+		return
+	}
+	if len(r.watchers) > 0 {
+		defer r.notify(userid, r.rank(userid))
+	}
+
 	if r.Type == RBTREE && len(r.M) < LOWER_THRESHOLD { // do convert
 		r.toggle()
 	}
@@ -99,11 +466,13 @@ func (r *RankSet) Delete(userid int32) {
 	case SORTEDSET:
 		r.S.Delete(userid)
 	case RBTREE:
-		score := r.M[userid]
-		_, n := r.R.Locate(score, userid)
+		_, n := r.R.Locate(r.key(r.M[userid]), r.T[userid], userid)
 		r.R.Delete(userid, n)
 	}
 	delete(r.M, userid)
+	delete(r.T, userid)
+	delete(r.U, userid)
+	r.observe(userid)
 }
 
 func (r *RankSet) Count() int32 {
@@ -113,7 +482,7 @@ func (r *RankSet) Count() int32 {
 }
 
 // range [A,B]
-func (r *RankSet) GetList(A, B int) (ids []int32, scores []int32) {
+func (r *RankSet) GetList(A, B int) (ids []int64, scores []int64) {
 	if A < 1 || A > B {
 		return
 	}
@@ -134,55 +503,541 @@ func (r *RankSet) GetList(A, B int) (ids []int32, scores []int32) {
 	case RBTREE:
 		ids, scores = r.R.GetList(A, B)
 	}
+	return ids, r.scores(scores)
+}
+
+// score of a user, ok is false if not exists
+func (r *RankSet) Score(userid int64) (score int64, ok bool) {
+	r.RLock()
+	defer r.RUnlock()
+	score, ok = r.M[userid]
 	return
 }
 
+// all users in the set
+func (r *RankSet) Users() []int64 {
+	r.RLock()
+	defer r.RUnlock()
+	ids := make([]int64, 0, len(r.M))
+	for id := range r.M {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // rank of a user
-func (r *RankSet) Rank(userid int32) (rank int32, score int32) {
+func (r *RankSet) Rank(userid int64) (rank int32, score int64) {
 	r.RLock()
 	defer r.RUnlock()
+	return int32(r.rank(userid)), r.M[userid]
+}
 
+func (r *RankSet) rank(userid int64) int {
 	switch r.Type {
 	case SORTEDSET:
-		rankno := r.S.Locate(userid)
-		return int32(rankno), r.M[userid]
+		return int(r.S.Locate(userid))
 	case RBTREE:
-		rankno, _ := r.R.Locate(r.M[userid], userid)
-		return int32(rankno), r.M[userid]
+		rankno, _ := r.R.Locate(r.key(r.M[userid]), r.T[userid], userid)
+		return rankno
+	}
+	return -1
+}
+
+// ranks and scores of users
+func (r *RankSet) Ranks(userids []int64) (ranks []int32, scores []int64) {
+	r.RLock()
+	defer r.RUnlock()
+
+	ranks = make([]int32, len(userids))
+	scores = make([]int64, len(userids))
+	for k, id := range userids {
+		ranks[k] = int32(r.rank(id))
+		scores[k] = r.M[id]
 	}
 	return
 }
 
+// ranks of users under tie semantics, -1 if not exists.
+// for TIES_FRACTIONAL, ranks are the competition ranks and the exact ones
+// are in fracs.
+func (r *RankSet) TieRanks(userids []int64, ties int) (ranks []int32, fracs []float64) {
+	r.RLock()
+	defer r.RUnlock()
+
+	ranks = make([]int32, len(userids))
+	if ties == TIES_FRACTIONAL {
+		fracs = make([]float64, len(userids))
+	}
+	for k, id := range userids {
+		rank, frac := r.tie_rank(id, ties)
+		ranks[k] = int32(rank)
+		if fracs != nil {
+			fracs[k] = frac
+		}
+	}
+	return
+}
+
+func (r *RankSet) tie_rank(userid int64, ties int) (rank int, frac float64) {
+	if ties == TIES_ORDINAL {
+		rank = r.rank(userid)
+		return rank, float64(rank)
+	}
+	if _, ok := r.M[userid]; !ok {
+		return -1, -1
+	}
+
+	var first, dense, count int
+	switch r.Type {
+	case SORTEDSET:
+		first, dense, count = r.S.GroupRank(userid)
+	case RBTREE:
+		first, dense, count = r.R.GroupRank(r.key(r.M[userid]), r.T[userid])
+	}
+	if first < 1 {
+		return -1, -1
+	}
+
+	switch ties {
+	case TIES_DENSE:
+		return dense, float64(dense)
+	case TIES_FRACTIONAL:
+		return first, float64(first) + float64(count-1)/2
+	}
+	return first, float64(first)
+}
+
+// users ranked around a user, [rank-before, rank+after]
+func (r *RankSet) Around(userid int64, before, after int) (ids []int64, scores []int64, ranks []int32) {
+	if before < 0 || after < 0 {
+		return
+	}
+	r.RLock()
+	defer r.RUnlock()
+
+	if _, ok := r.M[userid]; !ok {
+		return
+	}
+
+	rank := r.rank(userid)
+	if rank < 1 {
+		return
+	}
+
+	A, B := rank-before, rank+after
+	if A < 1 {
+		A = 1
+	}
+	if B > len(r.M) {
+		B = len(r.M)
+	}
+
+	switch r.Type {
+	case SORTEDSET:
+		ids, scores = r.S.GetList(A, B)
+	case RBTREE:
+		ids, scores = r.R.GetList(A, B)
+	}
+	r.scores(scores)
+
+	ranks = make([]int32, len(ids))
+	for k := range ranks {
+		ranks[k] = int32(A + k)
+	}
+	return
+}
+
+// users with score in [min,max], skipping offset users and returning at most
+// limit users, limit <= 0 means no limit. start is the rank of ids[0].
+func (r *RankSet) GetByScore(min, max int64, offset, limit int) (ids []int64, scores []int64, start int32) {
+	if min > max || offset < 0 {
+		return
+	}
+	r.RLock()
+	defer r.RUnlock()
+
+	var A, B int
+	min, max = r.key_range(min, max)
+	switch r.Type {
+	case SORTEDSET:
+		A, B = r.S.ScoreRange(min, max)
+	case RBTREE:
+		A, B = r.R.ScoreRange(min, max)
+	}
+
+	A += offset
+	if limit > 0 && B > A+limit-1 {
+		B = A + limit - 1
+	}
+	if A > B {
+		return
+	}
+
+	switch r.Type {
+	case SORTEDSET:
+		ids, scores = r.S.GetList(A, B)
+	case RBTREE:
+		ids, scores = r.R.GetList(A, B)
+	}
+	return ids, r.scores(scores), int32(A)
+}
+
+// count of users with score in [min,max]
+func (r *RankSet) CountInScoreRange(min, max int64) int32 {
+	if min > max {
+		return 0
+	}
+	r.RLock()
+	defer r.RUnlock()
+
+	var A, B int
+	min, max = r.key_range(min, max)
+	switch r.Type {
+	case SORTEDSET:
+		A, B = r.S.ScoreRange(min, max)
+	case RBTREE:
+		A, B = r.R.ScoreRange(min, max)
+	}
+
+	if A > B {
+		return 0
+	}
+	return int32(B - A + 1)
+}
+
+// watch changes within top-N ranks, top <= 0 to watch any change
+func (r *RankSet) Watch(top int) *Watcher {
+	if top < 0 {
+		top = 0
+	}
+	w := &Watcher{C: make(chan int64, 1), Done: make(chan struct{}), top: top}
+	r.Lock()
+	defer r.Unlock()
+	if r.retired {
+		close(w.Done)
+		return w
+	}
+	if r.watchers == nil {
+		r.watchers = make(map[*Watcher]bool)
+	}
+	r.watchers[w] = true
+	return w
+}
+
+// the set is no longer the live one of its id, watchers are told to
+// follow the one replacing it.
+func (r *RankSet) Retire() {
+	r.Lock()
+	defer r.Unlock()
+	if r.retired {
+		return
+	}
+	r.retired = true
+	for w := range r.watchers {
+		close(w.Done)
+	}
+	r.watchers = nil
+}
+
+func (r *RankSet) Unwatch(w *Watcher) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.watchers, w)
+}
+
+// notify watchers on a change of id affecting ranks from lo,
+// called with write lock held, so only the consumer races with us.
+func (r *RankSet) notify(id int64, lo int) {
+	for w := range r.watchers {
+		if w.top == 0 || lo <= w.top {
+			select {
+			case <-w.C: // replace the pending one
+			default:
+			}
+			w.C <- id
+		}
+	}
+}
+
+// move users into a group, group 0 to leave, observers are called
+// both before and after the move, so the old groups see it too.
+func (r *RankSet) SetGroup(ids []int64, group int64) {
+	r.Lock()
+	defer r.Unlock()
+	for _, id := range ids {
+		old := r.G[id]
+		if old == group {
+			continue
+		}
+		r.observe(id)
+		r.set_group(id, group)
+		r.observe(id)
+	}
+}
+
+func (r *RankSet) set_group(id, group int64) {
+	if old, ok := r.G[id]; ok {
+		delete(r.groups[old], id)
+		if len(r.groups[old]) == 0 {
+			delete(r.groups, old)
+		}
+		delete(r.G, id)
+	}
+	if group != 0 {
+		r.G[id] = group
+		if r.groups[group] == nil {
+			r.groups[group] = make(map[int64]bool)
+		}
+		r.groups[group][id] = true
+	}
+}
+
+// group of a user, 0 for none
+func (r *RankSet) Group(id int64) int64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.G[id]
+}
+
+// all groups with members
+func (r *RankSet) Groups() []int64 {
+	r.RLock()
+	defer r.RUnlock()
+	groups := make([]int64, 0, len(r.groups))
+	for g := range r.groups {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// members of a group, scored is set to only return members with scores
+func (r *RankSet) Members(group int64, scored bool) (ids []int64, scores []int64) {
+	r.RLock()
+	defer r.RUnlock()
+	for id := range r.groups[group] {
+		score, ok := r.M[id]
+		if scored && !ok {
+			continue
+		}
+		ids = append(ids, id)
+		scores = append(scores, score)
+	}
+	return
+}
+
+// observe every change of the set
+func (r *RankSet) Observe(f func(id int64)) *Observer {
+	o := &Observer{f: f}
+	r.Lock()
+	defer r.Unlock()
+	if r.observers == nil {
+		r.observers = make(map[*Observer]bool)
+	}
+	r.observers[o] = true
+	return o
+}
+
+func (r *RankSet) Unobserve(o *Observer) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.observers, o)
+}
+
+// called with write lock held on every change of a user
+func (r *RankSet) observe(id int64) {
+	r.dirty[id] = true
+	for o := range r.observers {
+		o.f(id)
+	}
+}
+
+// set or clear the aggregation the set is derived from
+func (r *RankSet) SetDerived(a *Aggregation) {
+	r.Lock()
+	defer r.Unlock()
+	r.Meta.Derived = a
+}
+
+// take the users changed since the last call
+func (r *RankSet) TakeDirty() []int64 {
+	r.Lock()
+	defer r.Unlock()
+	ids := make([]int64, 0, len(r.dirty))
+	for id := range r.dirty {
+		ids = append(ids, id)
+	}
+	r.dirty = make(map[int64]bool)
+	return ids
+}
+
+// mark users changed, for the ones taken but failed to persist
+func (r *RankSet) MarkDirty(ids []int64) {
+	r.Lock()
+	defer r.Unlock()
+	for _, id := range ids {
+		r.dirty[id] = true
+	}
+}
+
+// serialization of the set without users
+func (r *RankSet) MarshalInfo() ([]byte, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return msgpack.Marshal(&rankset_info{Float: r.Float, Order: r.Order, Meta: r.Meta})
+}
+
+// serialized users passed to f under read lock, nil ids for all users,
+// users no longer in the set are passed with nil.
+func (r *RankSet) Entries(ids []int64, f func(id int64, bin []byte) error) error {
+	r.RLock()
+	defer r.RUnlock()
+	if ids == nil {
+		ids = make([]int64, 0, len(r.M))
+		for id := range r.M {
+			ids = append(ids, id)
+		}
+		for id := range r.G {
+			if _, ok := r.M[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		score, ok := r.M[id]
+		group := r.G[id]
+		if !ok && group == 0 {
+			if err := f(id, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		bin, err := msgpack.Marshal(&rank_entry{Score: score, Scored: ok, Tie: r.T[id], Update: r.U[id], Group: group})
+		if err != nil {
+			return err
+		}
+		if err := f(id, bin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deserialization from a set info and the entries of users
+func (r *RankSet) UnmarshalEntries(info []byte, entries func(f func(id int64, bin []byte) error) error) error {
+	var i rankset_info
+	if err := msgpack.Unmarshal(info, &i); err != nil {
+		return err
+	}
+	dump := &rankset_dump{
+		M:     make(map[int64]int64),
+		T:     make(map[int64]int64),
+		U:     make(map[int64]int64),
+		G:     make(map[int64]int64),
+		Float: i.Float,
+		Order: i.Order,
+		Meta:  i.Meta,
+	}
+	err := entries(func(id int64, bin []byte) error {
+		var e rank_entry
+		if err := msgpack.Unmarshal(bin, &e); err != nil {
+			return err
+		}
+		if e.Scored {
+			dump.M[id] = e.Score
+		}
+		if e.Tie != 0 {
+			dump.T[id] = e.Tie
+		}
+		if e.Update != 0 {
+			dump.U[id] = e.Update
+		}
+		if e.Group != 0 {
+			dump.G[id] = e.Group
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.load(dump)
+	return nil
+}
+
 // serialization
 func (r *RankSet) Marshal() ([]byte, error) {
 	r.RLock()
 	defer r.RUnlock()
-	return msgpack.Marshal(r.M)
+	return msgpack.Marshal(&rankset_dump{M: r.M, T: r.T, U: r.U, G: r.G, Float: r.Float, Order: r.Order, Meta: r.Meta})
 }
 
+// a copy of the set to marshal without the lock, called with read lock held
+func (r *RankSet) copy_dump() *rankset_dump {
+	dump := &rankset_dump{Float: r.Float, Order: r.Order, Meta: r.Meta}
+	dump.M = copy_map(r.M)
+	dump.T = copy_map(r.T)
+	dump.U = copy_map(r.U)
+	dump.G = copy_map(r.G)
+	return dump
+}
+
+func copy_map(m map[int64]int64) map[int64]int64 {
+	c := make(map[int64]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// dumps of a bare ID => SCORE map from former versions are accepted,
+// msgpack stores integers in variable length, so the former map[int32]int32
+// is decoded into int64 directly.
 func (r *RankSet) Unmarshal(bin []byte) error {
-	m := make(map[int32]int32)
+	var dump rankset_dump
 	r.Lock()
 	defer r.Unlock()
-	err := msgpack.Unmarshal(bin, &m)
-	if err != nil {
-		return err
+	if err := msgpack.Unmarshal(bin, &dump.M); err != nil {
+		dump = rankset_dump{}
+		if err := msgpack.Unmarshal(bin, &dump); err != nil {
+			return err
+		}
 	}
+	r.load(&dump)
+	return nil
+}
 
-	r.M = m
+// build the set from a dump, called with write lock held
+func (r *RankSet) load(dump *rankset_dump) {
+	if dump.M == nil {
+		dump.M = make(map[int64]int64)
+	}
+	if dump.T == nil {
+		dump.T = make(map[int64]int64)
+	}
+	if dump.U == nil {
+		dump.U = make(map[int64]int64)
+	}
+	r.G = make(map[int64]int64)
+	r.groups = make(map[int64]map[int64]bool)
+	for id, group := range dump.G {
+		r.set_group(id, group)
+	}
+
+	r.M, r.T, r.U, r.Float, r.Order, r.Meta = dump.M, dump.T, dump.U, dump.Float, dump.Order, dump.Meta
 	if len(r.M) > UPPER_THRESHOLD {
-		for id, score := range m {
-			r.R.Insert(score, id)
+		for id, score := range r.M {
+			r.R.Insert(r.key(score), r.T[id], id)
 		}
 		r.Type = RBTREE
 		log.Debugf("rank restored into rbtree %v", len(r.M))
 	} else {
-		for id, score := range m {
-			r.S.Insert(id, score)
+		for id, score := range r.M {
+			r.S.Insert(id, r.key(score), r.T[id])
 		}
 		r.Type = SORTEDSET
 		log.Debugf("rank restored into sortedset %v", len(r.M))
 	}
-
-	return nil
 }
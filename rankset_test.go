@@ -1,23 +1,507 @@
 package main
 
 import (
+	"math"
 	"testing"
+	"time"
+
+	"gopkg.in/vmihailenco/msgpack.v2"
 )
 
 func TestRankSet(t *testing.T) {
 	rs := NewRankSet()
-	for i := int32(0); i <= UPPER_THRESHOLD+1; i++ {
-		rs.Update(i, i)
+	for i := int64(0); i <= UPPER_THRESHOLD+1; i++ {
+		rs.Update(i, i, 0, UPDATE_ALWAYS)
 	}
 	t.Log(rs.Count())
 
-	for i := int32(0); i <= UPPER_THRESHOLD-LOWER_THRESHOLD+3; i++ {
+	for i := int64(0); i <= UPPER_THRESHOLD-LOWER_THRESHOLD+3; i++ {
 		rs.Delete(i)
 	}
 	t.Log(rs.Count())
 
-	for i := int32(0); i <= UPPER_THRESHOLD-LOWER_THRESHOLD+3; i++ {
-		rs.Update(i, i)
+	for i := int64(0); i <= UPPER_THRESHOLD-LOWER_THRESHOLD+3; i++ {
+		rs.Update(i, i, 0, UPDATE_ALWAYS)
 	}
 	t.Log(rs.Count())
 }
+
+func TestAround(t *testing.T) {
+	for _, n := range []int64{10, UPPER_THRESHOLD + 10} {
+		rs := NewRankSet()
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, i, 0, UPDATE_ALWAYS)
+		}
+
+		ids, scores, ranks := rs.Around(n/2, 3, 3)
+		t.Log(ids, scores, ranks)
+		if len(ids) != 7 || ids[3] != n/2 || ranks[0] != int32(n-n/2-2) {
+			t.Fatal("around mismatch", rs.Type, ids, ranks)
+		}
+
+		// clamped at both ends
+		ids, _, ranks = rs.Around(n, 2, 2)
+		if len(ids) != 3 || ranks[0] != 1 || ids[0] != n {
+			t.Fatal("around top mismatch", rs.Type, ids, ranks)
+		}
+		ids, _, ranks = rs.Around(1, 2, 2)
+		if len(ids) != 3 || ranks[2] != int32(n) || ids[2] != 1 {
+			t.Fatal("around bottom mismatch", rs.Type, ids, ranks)
+		}
+
+		if ids, _, _ := rs.Around(n+1, 2, 2); len(ids) != 0 {
+			t.Fatal("around non-existent user", ids)
+		}
+	}
+}
+
+func TestGetByScore(t *testing.T) {
+	for _, n := range []int64{10, UPPER_THRESHOLD + 10} {
+		rs := NewRankSet()
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, i/2, 0, UPDATE_ALWAYS) // every score appears twice
+		}
+
+		ids, scores, start := rs.GetByScore(2, 3, 0, 0)
+		t.Log(ids, scores, start)
+		if len(ids) != 4 || scores[0] != 3 || scores[3] != 2 || start != int32(n-7+1) {
+			t.Fatal("score range mismatch", rs.Type, ids, scores, start)
+		}
+
+		ids, scores, start = rs.GetByScore(2, 3, 1, 2)
+		if len(ids) != 2 || scores[0] != 3 || scores[1] != 2 || start != int32(n-7+2) {
+			t.Fatal("score range with offset mismatch", rs.Type, ids, scores, start)
+		}
+
+		if ids, _, _ := rs.GetByScore(n, n+10, 0, 0); len(ids) != 0 {
+			t.Fatal("empty score range", ids)
+		}
+	}
+}
+
+func TestCountInScoreRange(t *testing.T) {
+	for _, n := range []int64{10, UPPER_THRESHOLD + 10} {
+		rs := NewRankSet()
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, i/2, 0, UPDATE_ALWAYS)
+		}
+
+		if c := rs.CountInScoreRange(2, 3); c != 4 {
+			t.Fatal("count mismatch", rs.Type, c)
+		}
+		if c := rs.CountInScoreRange(math.MinInt64, math.MaxInt64); c != int32(n) {
+			t.Fatal("count all mismatch", rs.Type, c)
+		}
+		if c := rs.CountInScoreRange(n, n+10); c != 0 {
+			t.Fatal("count empty mismatch", rs.Type, c)
+		}
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	rs := NewRankSet()
+	rs.Update(1, 10, 0, UPDATE_ALWAYS)
+	rs.Update(2, 20, 0, UPDATE_ALWAYS)
+
+	score, rank := rs.Increment(1, 15)
+	if score != 25 || rank != 1 {
+		t.Fatal("increment mismatch", score, rank)
+	}
+
+	score, rank = rs.Increment(3, 5)
+	if score != 5 || rank != 3 {
+		t.Fatal("increment new user mismatch", score, rank)
+	}
+
+	// saturation
+	rs.Update(4, math.MaxInt64-1, 0, UPDATE_ALWAYS)
+	if score, _ = rs.Increment(4, 10); score != math.MaxInt64 {
+		t.Fatal("increment overflow", score)
+	}
+	rs.Update(5, math.MinInt64+1, 0, UPDATE_ALWAYS)
+	if score, _ = rs.Increment(5, -10); score != math.MinInt64 {
+		t.Fatal("increment underflow", score)
+	}
+}
+
+// changed flag of an update
+func update(rs *RankSet, id, score, tie int64, mode int) bool {
+	changed, _, _ := rs.Update(id, score, tie, mode)
+	return changed
+}
+
+func TestUpdateMode(t *testing.T) {
+	rs := NewRankSet()
+	if !update(rs, 1, 10, 0, UPDATE_GREATER) {
+		t.Fatal("GREATER should insert new user")
+	}
+	if update(rs, 1, 5, 0, UPDATE_GREATER) || !update(rs, 1, 15, 0, UPDATE_GREATER) {
+		t.Fatal("GREATER mismatch")
+	}
+	if update(rs, 1, 20, 0, UPDATE_LESS) || !update(rs, 1, 12, 0, UPDATE_LESS) {
+		t.Fatal("LESS mismatch")
+	}
+	if update(rs, 1, 100, 0, UPDATE_NX) || !update(rs, 2, 100, 0, UPDATE_NX) {
+		t.Fatal("NX mismatch")
+	}
+	if update(rs, 3, 100, 0, UPDATE_XX) || !update(rs, 2, 50, 0, UPDATE_XX) {
+		t.Fatal("XX mismatch")
+	}
+	if update(rs, 2, 50, 0, UPDATE_ALWAYS) {
+		t.Fatal("same score should not be reported as changed")
+	}
+
+	_, score := rs.Rank(1)
+	if score != 12 || rs.Count() != 2 {
+		t.Fatal("stored score mismatch", score, rs.Count())
+	}
+}
+
+func TestUpdateBatch(t *testing.T) {
+	rs := NewRankSet()
+	rs.Update(1, 100, 0, UPDATE_ALWAYS)
+
+	ids := []int64{1, 2, 3, 1}
+	scores := []int64{50, 200, 300, 400}
+	ties := []int64{0, 0, 0, 0}
+	modes := []int{UPDATE_GREATER, UPDATE_ALWAYS, UPDATE_XX, UPDATE_ALWAYS}
+	changed, ranks, _ := rs.UpdateBatch(ids, scores, ties, modes)
+	t.Log(changed, ranks)
+	if changed[0] || !changed[1] || changed[2] || !changed[3] {
+		t.Fatal("batch changed mismatch", changed)
+	}
+	if ranks[0] != 1 || ranks[1] != 2 || ranks[2] != -1 || ranks[3] != 1 {
+		t.Fatal("batch ranks mismatch", ranks)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	rs := NewRankSet()
+	for i := int64(1); i <= 100; i++ {
+		rs.Update(i, i, 0, UPDATE_ALWAYS)
+	}
+
+	w := rs.Watch(10)
+	defer rs.Unwatch(w)
+
+	// change below the window
+	rs.Update(1, 2, 0, UPDATE_ALWAYS)
+	rs.Delete(5)
+	select {
+	case <-w.C:
+		t.Fatal("notified by change outside window")
+	default:
+	}
+
+	// bursts into the window are coalesced
+	rs.Update(1, 1000, 0, UPDATE_ALWAYS)
+	rs.Update(2, 1001, 0, UPDATE_ALWAYS)
+	rs.Delete(100)
+	if id := <-w.C; id != 100 {
+		t.Fatal("notified id mismatch", id)
+	}
+	select {
+	case <-w.C:
+		t.Fatal("notifications not coalesced")
+	default:
+	}
+}
+
+func TestRanks(t *testing.T) {
+	rs := NewRankSet()
+	for i := int64(1); i <= 10; i++ {
+		rs.Update(i, i, 0, UPDATE_ALWAYS)
+	}
+
+	ranks, scores := rs.Ranks([]int64{10, 1, 11})
+	if ranks[0] != 1 || ranks[1] != 10 || ranks[2] != -1 || scores[1] != 1 {
+		t.Fatal("ranks mismatch", ranks, scores)
+	}
+}
+
+func TestUnmarshalInt32Dump(t *testing.T) {
+	// dumps written before 64-bit ids & scores
+	old := make(map[int32]int32)
+	for i := int32(1); i <= UPPER_THRESHOLD+10; i++ {
+		old[i] = -i
+	}
+	bin, err := msgpack.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := NewRankSet()
+	if err := rs.Unmarshal(bin); err != nil {
+		t.Fatal(err)
+	}
+	if rank, score := rs.Rank(10); rank != 10 || score != -10 {
+		t.Fatal("restored rank mismatch", rank, score)
+	}
+}
+
+func TestTie(t *testing.T) {
+	for _, n := range []int64{10, 2000} {
+		rs := NewRankSet()
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, 100, n-i, UPDATE_ALWAYS) // later ids reach the score first
+		}
+		ids, _ := rs.GetList(1, 3)
+		if ids[0] != n || ids[1] != n-1 || ids[2] != n-2 {
+			t.Fatal("tie order mismatch", n, ids)
+		}
+
+		// same tie falls back to id
+		rs.Update(n+1, 100, 0, UPDATE_ALWAYS)
+		if ids, _ = rs.GetList(1, 2); ids[0] != n || ids[1] != n+1 {
+			t.Fatal("id order mismatch", n, ids)
+		}
+
+		// changing the tie alone is a change
+		if !update(rs, n+1, 100, -1, UPDATE_ALWAYS) || rs.rank(n+1) != 1 {
+			t.Fatal("tie update mismatch", n, rs.rank(n+1))
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	rs := NewRankSet()
+	rs.Float = true
+	rs.Update(1, float_score(-1.5), 0, UPDATE_ALWAYS)
+	rs.Update(2, float_score(0.25), 0, UPDATE_ALWAYS)
+	rs.Update(3, float_score(-0.5), 0, UPDATE_ALWAYS)
+	score, rank, _ := rs.IncrementFloat(1, 2)
+	if score != 0.5 || rank != 1 {
+		t.Fatal("increment float mismatch", score, rank)
+	}
+	for _, delta := range []float64{math.NaN(), math.Inf(1)} {
+		if _, _, ok := rs.IncrementFloat(1, delta); ok || score_float(rs.M[1]) != 0.5 {
+			t.Fatal("non-finite increment should be refused", delta)
+		}
+	}
+
+	ids, scores := rs.GetList(1, 3)
+	if ids[0] != 1 || ids[1] != 2 || ids[2] != 3 || score_float(scores[2]) != -0.5 {
+		t.Fatal("float order mismatch", ids, scores)
+	}
+	if n := rs.CountInScoreRange(float_score(-1), float_score(0.3)); n != 2 {
+		t.Fatal("float count mismatch", n)
+	}
+
+	// round trip keeps float flag and ties
+	rs.Update(4, float_score(0.25), -1, UPDATE_ALWAYS)
+	bin, err := rs.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs2 := NewRankSet()
+	if err := rs2.Unmarshal(bin); err != nil {
+		t.Fatal(err)
+	}
+	if !rs2.Float || rs2.rank(4) != 2 || rs2.rank(2) != 3 {
+		t.Fatal("dump mismatch", rs2.Float, rs2.rank(4), rs2.rank(2))
+	}
+}
+
+func TestOrderAsc(t *testing.T) {
+	for _, n := range []int64{10, 2000} {
+		rs := NewRankSet()
+		rs.Order = ORDER_ASC
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, i, 0, UPDATE_ALWAYS)
+		}
+		rs.Update(1, math.MaxInt64, 0, UPDATE_ALWAYS) // slowest now
+		rs.Update(2, math.MinInt64, 0, UPDATE_ALWAYS) // fastest now
+
+		ids, scores := rs.GetList(1, 2)
+		if ids[0] != 2 || ids[1] != 3 || scores[0] != math.MinInt64 || scores[1] != 3 {
+			t.Fatal("ascending list mismatch", n, ids, scores)
+		}
+		if rank, score := rs.Rank(1); rank != int32(n) || score != math.MaxInt64 {
+			t.Fatal("ascending rank mismatch", n, rank, score)
+		}
+
+		ids, scores, start := rs.GetByScore(5, 7, 0, 0)
+		if start != 4 || len(ids) != 3 || ids[0] != 5 || scores[2] != 7 {
+			t.Fatal("ascending score range mismatch", n, ids, scores, start)
+		}
+		if c := rs.CountInScoreRange(math.MinInt64, 4); c != 3 {
+			t.Fatal("ascending count mismatch", n, c)
+		}
+		ids, _, ranks := rs.Around(4, 1, 1)
+		if ids[0] != 3 || ids[2] != 5 || ranks[0] != 2 {
+			t.Fatal("ascending around mismatch", n, ids, ranks)
+		}
+
+		rs.Delete(3)
+		if ids, _ = rs.GetList(1, 2); ids[1] != 4 {
+			t.Fatal("ascending delete mismatch", n, ids)
+		}
+
+		// round trip keeps the order
+		bin, err := rs.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs2 := NewRankSet()
+		if err := rs2.Unmarshal(bin); err != nil {
+			t.Fatal(err)
+		}
+		if ids, _ = rs2.GetList(1, 1); rs2.Order != ORDER_ASC || ids[0] != 2 {
+			t.Fatal("ascending dump mismatch", n, ids)
+		}
+	}
+}
+
+func TestMetaDump(t *testing.T) {
+	rs := NewRankSet()
+	rs.Meta = SetMeta{Name: "daily", Owner: "ops", MaxSize: 100, Labels: map[string]string{"region": "eu"}, CreatedAt: 1476662400}
+	rs.Update(1, 1, 0, UPDATE_ALWAYS)
+	bin, err := rs.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs2 := NewRankSet()
+	if err := rs2.Unmarshal(bin); err != nil {
+		t.Fatal(err)
+	}
+	if rs2.Meta.Name != "daily" || rs2.Meta.MaxSize != 100 || rs2.Meta.Labels["region"] != "eu" || rs2.Meta.CreatedAt != 1476662400 {
+		t.Fatal("meta mismatch", rs2.Meta)
+	}
+}
+
+func TestCapped(t *testing.T) {
+	for _, n := range []int64{10, 2000} {
+		rs := NewRankSet()
+		rs.Meta.MaxSize = int32(n)
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, i*10, 0, UPDATE_ALWAYS)
+		}
+
+		// too low to make the cut, equal score loses on id
+		if changed, onboard, _ := rs.Update(n+1, 5, 0, UPDATE_ALWAYS); changed || onboard {
+			t.Fatal("low score should be rejected", n)
+		}
+		if _, onboard, _ := rs.Update(n+1, 10, 0, UPDATE_ALWAYS); onboard {
+			t.Fatal("equal score with larger id should be rejected", n)
+		}
+		if _, rank := rs.Increment(n+1, 1); rank != -1 || rs.Count() != int32(n) {
+			t.Fatal("increment should be rejected", n, rank)
+		}
+
+		// lowest one is evicted
+		if changed, onboard, _ := rs.Update(n+1, 15, 0, UPDATE_ALWAYS); !changed || !onboard {
+			t.Fatal("higher score should make the board", n)
+		}
+		if rank, _ := rs.Rank(1); rank != -1 || rs.Count() != int32(n) {
+			t.Fatal("lowest should be evicted", n, rank, rs.Count())
+		}
+		if rank, _ := rs.Rank(n + 1); rank != int32(n) {
+			t.Fatal("new entry rank mismatch", n, rank)
+		}
+
+		// existing users are never rejected
+		if _, onboard, _ := rs.Update(n+1, 0, 0, UPDATE_ALWAYS); !onboard {
+			t.Fatal("existing user should stay", n)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s := &server{ranks: make(map[uint64]*RankSet), history: make(map[uint64][]*RankSet)}
+	rs := NewRankSet()
+	rs.Update(1, 1, 0, UPDATE_ALWAYS)
+	s.ranks[1] = rs
+	s.history[1] = []*RankSet{NewRankSet()}
+
+	now := time.Now().Unix()
+	rs.SetExpiry(now + 3600)
+	if s.get(1) != rs || s.generation(1, 0) != rs {
+		t.Fatal("set should be alive")
+	}
+
+	// unreadable at once, purged by sweep
+	rs.SetExpiry(now - 1)
+	if s.get(1) != nil || s.generation(1, 0) != nil {
+		t.Fatal("expired set should be unreadable")
+	}
+	changes := make(map[uint64]bool)
+	s.sweep(time.Now(), changes)
+	if !changes[1] || s.ranks[1] != nil || s.history[1] != nil {
+		t.Fatal("expired set should be purged")
+	}
+
+	// an expired set is replaced on write
+	s.ranks[1] = rs
+	if rs2, err := s.get_or_create(1, false, 0); err != nil || rs2 == rs || rs2.Count() != 0 {
+		t.Fatal("expired set should be replaced", err)
+	}
+}
+
+func TestInactive(t *testing.T) {
+	rs := NewRankSet()
+	rs.Meta.Idle = 60
+	for i := int64(1); i <= 2000; i++ {
+		rs.Update(i, i, 0, UPDATE_ALWAYS)
+	}
+
+	// users 1..1500 went inactive, 1 submits again without a change
+	now := time.Now().Unix()
+	for i := int64(1); i <= 1500; i++ {
+		rs.U[i] = now - 120
+	}
+	if changed, _, touched := rs.Update(1, 1, 0, UPDATE_GREATER); changed || !touched {
+		t.Fatal("submission without a change should touch", changed, touched)
+	}
+
+	// round trip keeps the activity
+	bin, err := rs.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs2 := NewRankSet()
+	if err := rs2.Unmarshal(bin); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{ranks: map[uint64]*RankSet{1: rs2}, history: make(map[uint64][]*RankSet)}
+	changes := make(map[uint64]bool)
+	s.sweep(time.Now(), changes)
+	if !changes[1] || rs2.Count() != 501 || len(rs2.U) != 501 {
+		t.Fatal("inactive users mismatch", rs2.Count(), len(rs2.U))
+	}
+	if rank, _ := rs2.Rank(1); rank != 501 {
+		t.Fatal("active user should stay", rank)
+	}
+	if rank, _ := rs2.Rank(1500); rank != -1 {
+		t.Fatal("inactive user should be removed", rank)
+	}
+}
+
+func TestTieRanks(t *testing.T) {
+	for _, n := range []int64{10, 2000} {
+		rs := NewRankSet()
+		for i := int64(1); i <= n; i++ {
+			rs.Update(i, (n-i)/2, 0, UPDATE_ALWAYS) // two users per score
+		}
+		rs.Update(n+1, (n-1)/2, 0, UPDATE_ALWAYS) // three users of the top score
+		rs.Update(n+2, (n-1)/2, 1, UPDATE_ALWAYS) // same score, worse tie
+
+		ids := []int64{1, 2, n + 1, n + 2, 3, 4, n + 3}
+		ranks, fracs := rs.TieRanks(ids, TIES_ORDINAL)
+		if ranks[2] != 3 || ranks[3] != 4 || ranks[6] != -1 || fracs != nil {
+			t.Fatal("ordinal ranks mismatch", n, ranks)
+		}
+		ranks, _ = rs.TieRanks(ids, TIES_COMPETITION)
+		if ranks[0] != 1 || ranks[2] != 1 || ranks[3] != 4 || ranks[4] != 5 || ranks[5] != 5 || ranks[6] != -1 {
+			t.Fatal("competition ranks mismatch", n, ranks)
+		}
+		ranks, _ = rs.TieRanks(ids, TIES_DENSE)
+		if ranks[0] != 1 || ranks[3] != 2 || ranks[4] != 3 || ranks[6] != -1 {
+			t.Fatal("dense ranks mismatch", n, ranks)
+		}
+		ranks, fracs = rs.TieRanks(ids, TIES_FRACTIONAL)
+		if ranks[1] != 1 || fracs[1] != 2 || fracs[3] != 4 || fracs[5] != 5.5 || fracs[6] != -1 {
+			t.Fatal("fractional ranks mismatch", n, ranks, fracs)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	. "rank/proto"
+)
+
+// rpcs are called in process here, service_test.go runs against a live
+// server.
+
+func TestBatchStrict(t *testing.T) {
+	s := new_test_server()
+	s.strict = true
+	ctx := context.Background()
+	s.CreateSet(ctx, &Ranking_CreateSet{SetId: 1})
+	s.CreateSet(ctx, &Ranking_CreateSet{SetId: 2})
+
+	// a missing set fails the batch before any set is created
+	batch := &Ranking_ChangeBatch{}
+	for id := uint64(1); id <= 10; id++ {
+		batch.Changes = append(batch.Changes, &Ranking_Change{SetId: id, UserId64: 1, Score64: 1})
+	}
+	if _, err := s.RankChangeBatch(ctx, batch); err == nil {
+		t.Fatal("batch with undeclared sets should fail")
+	}
+	if len(s.ranks) != 2 || s.ranks[1].Count() != 0 || s.ranks[2].Count() != 0 {
+		t.Fatal("nothing should be applied", len(s.ranks))
+	}
+}
+
+func TestLegacyFields(t *testing.T) {
+	s := new_test_server()
+	ctx := context.Background()
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 1 << 40, Score64: math.MaxInt32})
+	r, _ := s.IncrementScore(ctx, &Ranking_Increment{SetId: 1, UserId64: 1 << 40, Delta64: 10})
+	if r.Score != math.MaxInt32 || r.Score64 != math.MaxInt32+10 {
+		t.Fatal("legacy score should saturate", r.Score, r.Score64)
+	}
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, Score64: math.MinInt32 - 1})
+	l, _ := s.QueryRankRange(ctx, &Ranking_Range{SetId: 1, A: 1, B: 2})
+	if !reflect.DeepEqual(l.UserIds, []int32{0, 2}) || !reflect.DeepEqual(l.Scores, []int32{math.MaxInt32, math.MinInt32}) {
+		t.Fatal("legacy fields mismatch", l.UserIds, l.Scores)
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	s := new_test_server()
+	ctx := context.Background()
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 1, ScoreFloat: 1, Float: true})
+	if _, err := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, ScoreFloat: math.NaN()}); err != ERROR_INVALID_ARGUMENT {
+		t.Fatal("NaN score should be refused", err)
+	}
+	if _, err := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, ScoreFloat: math.Inf(1)}); err != ERROR_INVALID_ARGUMENT {
+		t.Fatal("infinite score should be refused", err)
+	}
+	if _, err := s.IncrementScore(ctx, &Ranking_Increment{SetId: 1, UserId64: 1, DeltaFloat: math.NaN()}); err != ERROR_INVALID_ARGUMENT {
+		t.Fatal("NaN delta should be refused", err)
+	}
+	batch := &Ranking_ChangeBatch{Changes: []*Ranking_Change{{SetId: 1, UserId64: 3, ScoreFloat: 2}, {SetId: 1, UserId64: 4, ScoreFloat: math.NaN()}}}
+	if _, err := s.RankChangeBatch(ctx, batch); err != ERROR_INVALID_ARGUMENT {
+		t.Fatal("NaN in a batch should be refused", err)
+	}
+	batch.Changes[1].ScoreFloat = math.Inf(-1)
+	if _, err := s.RankChangeBatch(ctx, batch); err != ERROR_INVALID_ARGUMENT {
+		t.Fatal("infinity in a batch should be refused", err)
+	}
+	if rs := s.ranks[1]; rs.Count() != 1 || score_float(rs.M[1]) != 1 {
+		t.Fatal("nothing should be applied", rs.Count())
+	}
+
+	// infinities summed up leave the user out
+	f1, f2 := NewRankSet(), NewRankSet()
+	f1.Float, f2.Float = true, true
+	f1.Update(1, float_score(math.Inf(1)), 0, UPDATE_ALWAYS)
+	f2.Update(1, float_score(math.Inf(-1)), 0, UPDATE_ALWAYS)
+	f2.Update(2, float_score(1), 0, UPDATE_ALWAYS)
+	a := &Aggregation{Sources: []uint64{1, 2}, Weights: []float64{1, 1}, Mode: AGGREGATE_SUM}
+	if scores := a.materialize([]*RankSet{f1, f2}, true); len(scores) != 1 || score_float(scores[2]) != 1 {
+		t.Fatal("non-finite sum should be left out", scores)
+	}
+}
@@ -1,18 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"errors"
-	"fmt"
+	"io"
+	"math"
 	"os"
-	"os/signal"
-	"strconv"
+	"sort"
 	"sync"
-	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/boltdb/bolt"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
 import (
@@ -24,27 +25,86 @@ const (
 )
 
 const (
-	BOLTDB_FILE    = "/data/RANK-DUMP.DAT"
-	BOLTDB_BUCKET  = "RANKING"
-	CHANGES_SIZE   = 65536
-	CHECK_INTERVAL = time.Minute // if ranking has changed, how long to check
+	BOLTDB_FILE           = "/data/RANK-DUMP.DAT"
+	BOLTDB_BUCKET         = "RANKING"              // whole sets of former versions, migrated on restore
+	BOLTDB_SETS_BUCKET    = "RANKING-SETS"         // a bucket per set, keyed by setid
+	BOLTDB_SET_INFO       = "info"                 // the set without users, in a set bucket
+	BOLTDB_SET_USERS      = "users"                // a bucket of users in a set bucket, keyed by big-endian id
+	BOLTDB_HISTORY_BUCKET = "RANKING-HISTORY"      // past generations of periodic sets, keyed by "setid/start"
+	WAL_FILE              = "/data/RANK-WAL"       // segments of the write-ahead log, as RANK-WAL.seq
+	SNAPSHOT_DIR          = "/data/RANK-SNAPSHOTS" // snapshot files of the dir storage
+	CHANGES_SIZE          = 65536
+	CHECK_INTERVAL        = time.Minute // if ranking has changed, how long to check
+	SWEEP_BATCH           = 1024        // inactive users deleted under one lock
+)
+
+const (
+	STREAM_ACK_COUNT    = 1024        // ack the stream after this many changes
+	STREAM_ACK_INTERVAL = time.Second // or after this long if any change is unacked
+)
+
+const (
+	WATCH_MAX_TOP   = 1000                   // max window of WatchTop
+	WATCH_MAX_USERS = 100                    // max users of WatchUsers
+	WATCH_INTERVAL  = 100 * time.Millisecond // min interval between notifications of a watch
 )
 
 var (
-	OK                    = &Ranking_Nil{}
-	ERROR_NAME_NOT_EXISTS = errors.New("name not exists")
+	OK                     = &Ranking_Nil{}
+	ERROR_NAME_NOT_EXISTS  = errors.New("name not exists")
+	ERROR_NAME_EXISTS      = errors.New("name already exists")
+	ERROR_INVALID_ARGUMENT = errors.New("invalid argument")
+	ERROR_SHUTTING_DOWN    = errors.New("server shutting down")
 )
 
 type server struct {
-	ranks   map[uint64]*RankSet
-	pending chan uint64
+	ranks    map[uint64]*RankSet
+	history  map[uint64][]*RankSet // past generations of periodic sets, newest first
+	derivers map[uint64]*deriver   // continuously aggregated sets
+	pending  chan uint64
+	strict   bool          // sets must be declared by CreateSet before changes
+	fsync    time.Duration // fsync policy of the wal
+	wal      *wal
+	store    Storage
+	dumped   map[uint64]*RankSet // sets as last dumped, owned by the persistence task
+	archived map[uint64]bool     // sets with past generations changed since the last dump
+	snapfile string              // a snapshot file to restore on startup
+	die      chan struct{}       // stops the persistence task
+	quit     chan struct{}       // ends open streams on shutdown
+	done     chan error          // result of the final checkpoint
 	sync.RWMutex
 }
 
 func (s *server) init() {
 	s.ranks = make(map[uint64]*RankSet)
+	s.history = make(map[uint64][]*RankSet)
+	s.derivers = make(map[uint64]*deriver)
 	s.pending = make(chan uint64, CHANGES_SIZE)
-	s.restore()
+	s.dumped = make(map[uint64]*RankSet)
+	s.archived = make(map[uint64]bool)
+	s.die = make(chan struct{})
+	s.quit = make(chan struct{})
+	s.done = make(chan error, 1)
+	last := s.restore(WAL_FILE)
+
+	// changes from now on are logged into a new segment
+	w, err := open_wal(WAL_FILE, s.fsync, last+1)
+	if err != nil {
+		log.Panic(err)
+		os.Exit(-1)
+	}
+	s.wal = w
+	if s.snapfile != "" {
+		s.restore_snapshot(s.snapfile)
+	}
+	s.lock_write(func() {
+		for id, rs := range s.ranks {
+			s.wal.observe(id, rs)
+			if rs.Meta.Derived != nil {
+				s.start_deriver(id, rs.Meta.Derived).mark_full()
+			}
+		}
+	})
 	go s.persistence_task()
 }
 
@@ -60,168 +120,1237 @@ func (s *server) lock_write(f func()) {
 	f()
 }
 
-func (s *server) RankChange(ctx context.Context, p *Ranking_Change) (*Ranking_Nil, error) {
-	// check name existence
-	var rs *RankSet
+// get a live rankset by id, nil if not exists or expired, a periodic set
+// past its period is rotated first. changes must go through update or
+// upsert instead, a set got here may be rotated meanwhile.
+func (s *server) get(setid uint64) (rs *RankSet) {
+	now := time.Now().Unix()
+	s.lock_read(func() {
+		rs = s.ranks[setid]
+	})
+	if rs != nil && rs.Expired(now) {
+		return nil
+	}
+	if rs != nil && rs.due(now) {
+		s.lock_write(func() {
+			if s.writable() == nil { // rotated on the next start otherwise
+				rs = s.live(setid, now)
+			}
+		})
+	}
+	return
+}
+
+// get the live rankset by id with write lock held, an expired one is
+// dropped along with its past generations, a periodic one past its period
+// is rotated.
+func (s *server) live(setid uint64, now int64) *RankSet {
+	rs := s.ranks[setid]
+	if rs != nil && rs.Expired(now) {
+		delete(s.ranks, setid)
+		delete(s.history, setid)
+		s.replaced(setid, rs)
+		return nil
+	}
+	if rs != nil && rs.due(now) {
+		rs = s.rotate_set(setid, rs, now)
+	}
+	return rs
+}
+
+// change a live set, f runs under server read lock, so rotations and
+// replacements wait for it, no change lands in a retired set. f must
+// neither take the server lock nor send to pending.
+func (s *server) update(setid uint64, f func(rs *RankSet)) error {
+	return s.with(setid, false, false, Ranking_DESC, f)
+}
+
+// update, the set is created if not exists unless in strict mode
+func (s *server) upsert(setid uint64, float bool, order Ranking_Order, f func(rs *RankSet)) error {
+	return s.with(setid, true, float, order, f)
+}
+
+func (s *server) with(setid uint64, create bool, float bool, order Ranking_Order, f func(rs *RankSet)) error {
+	for {
+		now := time.Now().Unix()
+		done := false
+		var err error
+		s.lock_read(func() {
+			if err = s.writable(); err != nil {
+				return
+			}
+			if rs := s.ranks[setid]; rs != nil && !rs.Expired(now) && !rs.due(now) {
+				f(rs)
+				done = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if done { // a change that could not be logged fails too
+			return s.wal.err()
+		}
+
+		// create, drop or rotate under write lock, then retry
+		s.lock_write(func() {
+			if err = s.writable(); err != nil {
+				return
+			}
+			if create {
+				_, err = s.resolve(setid, float, order, now)
+			} else if s.live(setid, now) == nil {
+				err = ERROR_NAME_NOT_EXISTS
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// refuse changes once shutdown has started, so nothing lands after the
+// final checkpoint, or while the wal has failed. called with server lock
+// held.
+func (s *server) writable() error {
+	select {
+	case <-s.quit:
+		return ERROR_SHUTTING_DOWN
+	default:
+	}
+	return s.wal.err()
+}
+
+// get the rankset by id, create one if not exists unless in strict mode,
+// float & order only apply to the newly created one.
+func (s *server) get_or_create(setid uint64, float bool, order Ranking_Order) (rs *RankSet, err error) {
 	s.lock_write(func() {
-		rs = s.ranks[p.SetId]
-		if rs == nil {
-			rs = NewRankSet()
-			s.ranks[p.SetId] = rs
+		rs, err = s.resolve(setid, float, order, time.Now().Unix())
+	})
+	return
+}
+
+// get_or_create with server write lock held
+func (s *server) resolve(setid uint64, float bool, order Ranking_Order, now int64) (*RankSet, error) {
+	rs := s.live(setid, now)
+	if rs == nil {
+		if s.strict {
+			return nil, grpc.Errorf(codes.NotFound, "set %v not declared", setid)
+		}
+		rs = NewRankSet()
+		rs.Float = float
+		rs.Order = int(order)
+		rs.Meta.CreatedAt = now
+		s.ranks[setid] = rs
+		s.replaced(setid, nil)
+	}
+	return rs, nil
+}
+
+// apply a change, returns whether the score has changed and whether
+// the user is on the board
+func (s *server) change(p *Ranking_Change) (changed bool, onboard bool, err error) {
+	// apply update on the rankset, created if not exists
+	var touched bool
+	e := s.upsert(p.SetId, p.Float, p.Order, func(rs *RankSet) {
+		var score int64
+		if score, err = score_arg(rs, p.Score64, p.Score, p.ScoreFloat); err == nil {
+			changed, onboard, touched = rs.Update(pick64(p.UserId64, p.UserId), score, p.Tie, int(p.Mode))
 		}
 	})
+	if e != nil {
+		return false, false, e
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if changed || touched { // the activity is persisted too
+		s.pending <- p.SetId
+	}
+	return changed, onboard, nil
+}
+
+func (s *server) RankChange(ctx context.Context, p *Ranking_Change) (*Ranking_ChangeResult, error) {
+	changed, onboard, err := s.change(p)
+	if err != nil {
+		return nil, err
+	}
+	return &Ranking_ChangeResult{Changed: changed, OnBoard: onboard}, nil
+}
+
+func (s *server) StreamRankChanges(stream RankingService_StreamRankChangesServer) error {
+	// receiving in another goroutine, so acks can be sent on timer
+	changes := make(chan *Ranking_Change)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			p, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case changes <- p:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	ack := &Ranking_Ack{}
+	unacked := 0
+	ticker := time.NewTicker(STREAM_ACK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case p := <-changes:
+			changed, _, err := s.change(p)
+			if err != nil {
+				return err
+			}
+			if changed {
+				ack.Changed++
+			}
+			ack.Applied++
+			ack.Seq = p.Seq
+			unacked++
+			if unacked >= STREAM_ACK_COUNT {
+				if err := stream.Send(ack); err != nil {
+					return err
+				}
+				unacked = 0
+			}
+		case <-ticker.C:
+			if unacked > 0 {
+				if err := stream.Send(ack); err != nil {
+					return err
+				}
+				unacked = 0
+			}
+		case err := <-errs:
+			if err != io.EOF {
+				return err
+			}
+			// producer finished, final ack
+			return stream.Send(ack)
+		case <-s.quit:
+			// shutting down, the producer resends changes after the last seq
+			return stream.Send(ack)
+		}
+	}
+}
+
+func (s *server) RankChangeBatch(ctx context.Context, p *Ranking_ChangeBatch) (*Ranking_ChangeBatchResult, error) {
+	// group changes by set
+	groups := make(map[uint64][]int)
+	for k, c := range p.Changes {
+		if math.IsNaN(c.ScoreFloat) || math.IsInf(c.ScoreFloat, 0) {
+			return nil, ERROR_INVALID_ARGUMENT
+		}
+		groups[c.SetId] = append(groups[c.SetId], k)
+	}
+
+	result := &Ranking_ChangeBatchResult{
+		Changed: make([]bool, len(p.Changes)),
+		Ranks:   make([]int32, len(p.Changes)),
+	}
+	var dirty []uint64
+	for applied := false; !applied; {
+		// resolve all sets first under one lock, nothing is created unless
+		// all sets exist or can be created, so nothing is applied on error
+		sets := make(map[uint64]*RankSet)
+		var err error
+		s.lock_write(func() {
+			if err = s.writable(); err != nil {
+				return
+			}
+			now := time.Now().Unix()
+			for setid := range groups {
+				if s.strict && s.live(setid, now) == nil {
+					err = grpc.Errorf(codes.NotFound, "set %v not declared", setid)
+					return
+				}
+			}
+			for setid, idx := range groups {
+				sets[setid], _ = s.resolve(setid, p.Changes[idx[0]].Float, p.Changes[idx[0]].Order, now)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// apply under server read lock like update, resolved again if
+		// any set was rotated or replaced in between
+		s.lock_read(func() {
+			if err = s.writable(); err != nil {
+				return
+			}
+			now := time.Now().Unix()
+			for setid, rs := range sets {
+				if s.ranks[setid] != rs || rs.Expired(now) || rs.due(now) {
+					return
+				}
+			}
+			for setid, idx := range groups {
+				rs := sets[setid]
+				ids := make([]int64, len(idx))
+				scores := make([]int64, len(idx))
+				ties := make([]int64, len(idx))
+				modes := make([]int, len(idx))
+				for k, i := range idx {
+					c := p.Changes[i]
+					ids[k] = pick64(c.UserId64, c.UserId)
+					scores[k], _ = score_arg(rs, c.Score64, c.Score, c.ScoreFloat) // checked above
+					ties[k] = c.Tie
+					modes[k] = int(c.Mode)
+				}
+
+				// apply the whole group under one lock
+				changed, ranks, touched := rs.UpdateBatch(ids, scores, ties, modes)
+				for k, i := range idx {
+					result.Changed[i] = changed[k]
+					result.Ranks[i] = ranks[k]
+				}
+				for _, c := range changed {
+					touched = touched || c
+				}
+				if touched {
+					dirty = append(dirty, setid)
+				}
+			}
+			applied = true
+		})
+	}
+
+	for _, setid := range dirty {
+		s.pending <- setid
+	}
+	if err := s.wal.err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-	// apply update on the rankset
-	rs.Update(p.UserId, p.Score)
+func (s *server) IncrementScore(ctx context.Context, p *Ranking_Increment) (*Ranking_UserRank, error) {
+	// read-modify-write under the rankset lock
+	id := pick64(p.UserId64, p.UserId)
+	var result *Ranking_UserRank
+	err := s.upsert(p.SetId, p.Float, p.Order, func(rs *RankSet) {
+		if rs.Float {
+			if score, rank, ok := rs.IncrementFloat(id, p.DeltaFloat); ok {
+				result = &Ranking_UserRank{Rank: rank, ScoreFloat: score}
+			}
+			return
+		}
+		score, rank := rs.Increment(id, pick64(p.Delta64, p.Delta))
+		result = &Ranking_UserRank{Rank: rank, Score: score32(score), Score64: score}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
 	s.pending <- p.SetId
-	return OK, nil
+	return result, nil
 }
 
 func (s *server) QueryRankRange(ctx context.Context, p *Ranking_Range) (*Ranking_RankList, error) {
-	var rs *RankSet
-	s.lock_read(func() {
-		rs = s.ranks[p.SetId]
-	})
+	rs := s.generation(p.SetId, p.Generation)
 
 	if rs == nil {
 		return nil, ERROR_NAME_NOT_EXISTS
 	}
 
 	ids, cups := rs.GetList(int(p.A), int(p.B))
-	return &Ranking_RankList{UserIds: ids, Scores: cups}, nil
+	s32, s64, sf := score_fields(rs, cups)
+	list := &Ranking_RankList{UserIds: ids32(ids), Scores: s32, UserIds64: ids, Scores64: s64, ScoresFloat: sf}
+	if p.Ties != Ranking_ORDINAL {
+		list.Ranks, list.RanksFractional = rs.TieRanks(ids, int(p.Ties))
+	}
+	return list, nil
 }
 
 func (s *server) QueryUsers(ctx context.Context, p *Ranking_Users) (*Ranking_UserList, error) {
-	var rs *RankSet
-	s.lock_read(func() {
-		rs = s.ranks[p.SetId]
+	rs := s.generation(p.SetId, p.Generation)
+
+	if rs == nil {
+		return nil, ERROR_NAME_NOT_EXISTS
+	}
+
+	userids := pick64s(p.UserIds64, p.UserIds)
+	ranks, scores := rs.Ranks(userids)
+	s32, s64, sf := score_fields(rs, scores)
+	list := &Ranking_UserList{Ranks: ranks, Scores: s32, Scores64: s64, ScoresFloat: sf}
+	if p.Ties != Ranking_ORDINAL {
+		list.Ranks, list.RanksFractional = rs.TieRanks(userids, int(p.Ties))
+	}
+	return list, nil
+}
+
+func (s *server) QueryAroundUser(ctx context.Context, p *Ranking_AroundUser) (*Ranking_AroundList, error) {
+	rs := s.generation(p.SetId, p.Generation)
+
+	if rs == nil {
+		return nil, ERROR_NAME_NOT_EXISTS
+	}
+
+	ids, scores, ranks := rs.Around(pick64(p.UserId64, p.UserId), int(p.Before), int(p.After))
+	s32, s64, sf := score_fields(rs, scores)
+	list := &Ranking_AroundList{UserIds: ids32(ids), Scores: s32, Ranks: ranks, UserIds64: ids, Scores64: s64, ScoresFloat: sf}
+	if p.Ties != Ranking_ORDINAL {
+		list.Ranks, list.RanksFractional = rs.TieRanks(ids, int(p.Ties))
+	}
+	return list, nil
+}
+
+func (s *server) QueryScoreRange(ctx context.Context, p *Ranking_ScoreRange) (*Ranking_ScoreList, error) {
+	rs := s.generation(p.SetId, p.Generation)
+
+	if rs == nil {
+		return nil, ERROR_NAME_NOT_EXISTS
+	}
+
+	min, err := score_arg(rs, p.Min64, p.Min, p.MinFloat)
+	if err != nil {
+		return nil, err
+	}
+	max, err := score_arg(rs, p.Max64, p.Max, p.MaxFloat)
+	if err != nil {
+		return nil, err
+	}
+	ids, scores, start := rs.GetByScore(min, max, int(p.Offset), int(p.Limit))
+	s32, s64, sf := score_fields(rs, scores)
+	list := &Ranking_ScoreList{UserIds: ids32(ids), Scores: s32, StartRank: start, UserIds64: ids, Scores64: s64, ScoresFloat: sf}
+	if p.Ties != Ranking_ORDINAL {
+		list.Ranks, list.RanksFractional = rs.TieRanks(ids, int(p.Ties))
+	}
+	return list, nil
+}
+
+func (s *server) CountScoreRange(ctx context.Context, p *Ranking_ScoreCount) (*Ranking_Count, error) {
+	rs := s.generation(p.SetId, p.Generation)
+
+	if rs == nil {
+		return nil, ERROR_NAME_NOT_EXISTS
+	}
+
+	min, err := score_arg(rs, p.Min64, p.Min, p.MinFloat)
+	if err != nil {
+		return nil, err
+	}
+	max, err := score_arg(rs, p.Max64, p.Max, p.MaxFloat)
+	if err != nil {
+		return nil, err
+	}
+	return &Ranking_Count{Count: rs.CountInScoreRange(min, max)}, nil
+}
+
+func (s *server) AggregateSets(ctx context.Context, p *Ranking_Aggregate) (*Ranking_Count, error) {
+	if len(p.SourceIds) == 0 || len(p.Weights) > 0 && len(p.Weights) != len(p.SourceIds) {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+	if p.Aggregation < Ranking_SUM || p.Aggregation > Ranking_MAX {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+	if p.Group && (len(p.SourceIds) != 1 || p.Intersect) {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+
+	spec := &Aggregation{Sources: p.SourceIds, Weights: p.Weights, Mode: int(p.Aggregation), Intersect: p.Intersect, Group: p.Group}
+	if len(spec.Weights) == 0 {
+		spec.Weights = make([]float64, len(spec.Sources))
+		for k := range spec.Weights {
+			spec.Weights[k] = 1
+		}
+	}
+
+	// sources must exist and agree on float
+	sources := make([]*RankSet, len(spec.Sources))
+	for k, src := range spec.Sources {
+		if sources[k] = s.get(src); sources[k] == nil {
+			return nil, ERROR_NAME_NOT_EXISTS
+		}
+		if sources[k].Float != sources[0].Float {
+			return nil, ERROR_INVALID_ARGUMENT
+		}
+	}
+	float := sources[0].Float
+	for _, w := range spec.Weights {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, ERROR_INVALID_ARGUMENT
+		}
+	}
+	if !float {
+		for _, w := range spec.Weights {
+			if w != math.Trunc(w) || math.Abs(w) >= math.MaxInt64 {
+				return nil, ERROR_INVALID_ARGUMENT
+			}
+		}
+	}
+
+	dest, err := s.get_or_create(p.DestId, float, Ranking_Order(sources[0].Order))
+	if err != nil {
+		return nil, err
+	}
+	if dest.Float != float {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+
+	// a continuous set is only written by its deriver, which observes the
+	// sources before the initial materialization, so no change is missed
+	// in between.
+	var d *deriver
+	s.lock_write(func() {
+		if err = s.writable(); err != nil {
+			return
+		}
+		if dest = s.ranks[p.DestId]; dest == nil {
+			err = ERROR_NAME_NOT_EXISTS
+			return
+		}
+		for _, src := range spec.Sources {
+			if s.depends(src, p.DestId) {
+				err = ERROR_INVALID_ARGUMENT
+				return
+			}
+		}
+		if d := s.derivers[p.DestId]; d != nil {
+			d.stop()
+			delete(s.derivers, p.DestId)
+		}
+		if p.Continuous {
+			dest.SetDerived(spec)
+			d = s.start_deriver(p.DestId, spec)
+			d.mark_full()
+		} else {
+			dest.SetDerived(nil)
+		}
+		s.wal.meta(p.DestId, dest)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the initial fill of a continuous set is left to its deriver
+	if d != nil {
+		if err := s.wal.err(); err != nil {
+			return nil, err
+		}
+		select {
+		case count := <-d.filled:
+			return &Ranking_Count{Count: count}, nil
+		case <-d.die: // aggregated again or deleted meanwhile
+			return &Ranking_Count{Count: dest.Count()}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var count int32
+	scores := spec.materialize(sources, float)
+	err = s.update(p.DestId, func(rs *RankSet) {
+		sync_scores(rs, scores)
+		count = rs.Count()
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.pending <- p.DestId
+	return &Ranking_Count{Count: count}, nil
+}
+
+func (s *server) JoinGroup(ctx context.Context, p *Ranking_Membership) (*Ranking_Nil, error) {
+	if p.GroupId == 0 {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+	err := s.upsert(p.SetId, false, Ranking_DESC, func(rs *RankSet) {
+		rs.SetGroup(p.UserIds, p.GroupId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.pending <- p.SetId
+	return OK, nil
+}
+
+func (s *server) LeaveGroup(ctx context.Context, p *Ranking_Membership) (*Ranking_Nil, error) {
+	err := s.update(p.SetId, func(rs *RankSet) {
+		rs.SetGroup(p.UserIds, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.pending <- p.SetId
+	return OK, nil
+}
 
+func (s *server) QueryGroupMembers(ctx context.Context, p *Ranking_Group) (*Ranking_Members, error) {
+	rs := s.get(p.SetId)
 	if rs == nil {
 		return nil, ERROR_NAME_NOT_EXISTS
 	}
+	ids, _ := rs.Members(p.GroupId, false)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return &Ranking_Members{UserIds: ids}, nil
+}
 
-	ranks := make([]int32, 0, len(p.UserIds))
-	scores := make([]int32, 0, len(p.UserIds))
-	for _, id := range p.UserIds {
-		rank, score := rs.Rank(id)
-		ranks = append(ranks, rank)
-		scores = append(scores, score)
+func (s *server) WatchTop(p *Ranking_WatchTop, stream RankingService_WatchTopServer) error {
+	if p.Top < 1 || p.Top > WATCH_MAX_TOP {
+		return ERROR_INVALID_ARGUMENT
+	}
+
+	rs := s.get(p.SetId)
+
+	if rs == nil {
+		return ERROR_NAME_NOT_EXISTS
+	}
+
+	// the initial list, and lists on changes
+	var ids, scores []int64
+	sent := false
+	return s.watch(stream.Context(), p.SetId, rs, int(p.Top), func(rs *RankSet, by int64) error {
+		newids, newscores := rs.GetList(1, int(p.Top))
+		if sent && equal(ids, newids) && equal(scores, newscores) {
+			return nil
+		}
+		ids, scores, sent = newids, newscores, true
+		s32, s64, sf := score_fields(rs, scores)
+		return stream.Send(&Ranking_RankList{UserIds: ids32(ids), Scores: s32, UserIds64: ids, Scores64: s64, ScoresFloat: sf})
+	})
+}
+
+func (s *server) WatchUsers(p *Ranking_WatchUsers, stream RankingService_WatchUsersServer) error {
+	userids := pick64s(p.UserIds64, p.UserIds)
+	if len(userids) == 0 || len(userids) > WATCH_MAX_USERS {
+		return ERROR_INVALID_ARGUMENT
+	}
+
+	rs := s.get(p.SetId)
+
+	if rs == nil {
+		return ERROR_NAME_NOT_EXISTS
+	}
+
+	// initial ranks
+	ranks, scores := rs.Ranks(userids)
+	for k, id := range userids {
+		event := &Ranking_UserEvent{UserId: id32(id), Rank: ranks[k], UserId64: id}
+		event.Score, event.Score64, event.ScoreFloat = score_field(rs, scores[k])
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+
+	// events of users whose ranks changed
+	return s.watch(stream.Context(), p.SetId, rs, 0, func(rs *RankSet, by int64) error {
+		newranks, newscores := rs.Ranks(userids)
+		for k, id := range userids {
+			if newranks[k] == ranks[k] {
+				continue
+			}
+			event := &Ranking_UserEvent{UserId: id32(id), Rank: newranks[k], OldRank: ranks[k], By: id32(by), UserId64: id, By64: by}
+			event.Score, event.Score64, event.ScoreFloat = score_field(rs, newscores[k])
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+		ranks = newranks
+		return nil
+	})
+}
+
+// watch a set until the stream ends, notify is called at first and on
+// changes of the set, with the user whose change triggered it, 0 if
+// unknown. a rotated or replaced set is followed by the one taking its
+// place.
+func (s *server) watch(ctx context.Context, setid uint64, rs *RankSet, top int, notify func(rs *RankSet, by int64) error) error {
+	var by int64
+	for {
+		w := rs.Watch(top)
+		retired, err := func() (bool, error) {
+			defer rs.Unwatch(w)
+			for {
+				if err := notify(rs, by); err != nil {
+					return false, err
+				}
+
+				select {
+				case by = <-w.C:
+				case <-w.Done:
+					by = 0
+					return true, nil
+				case <-ctx.Done():
+					return false, nil
+				case <-s.quit:
+					return false, nil
+				}
+
+				// bursts during this interval are coalesced into one notification
+				select {
+				case <-time.After(WATCH_INTERVAL):
+				case <-ctx.Done():
+					return false, nil
+				case <-s.quit:
+					return false, nil
+				}
+			}
+		}()
+		if !retired {
+			return err
+		}
+
+		// rotated or replaced, follow the set taking its place
+		if rs = s.get(setid); rs == nil {
+			return ERROR_NAME_NOT_EXISTS
+		}
+	}
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// 64-bit fields take precedence over the legacy 32-bit ones when set
+func pick64(v64 int64, v32 int32) int64 {
+	if v64 != 0 {
+		return v64
+	}
+	return int64(v32)
+}
+
+func pick64s(v64 []int64, v32 []int32) []int64 {
+	if len(v64) > 0 {
+		return v64
+	}
+	v := make([]int64, len(v32))
+	for k := range v32 {
+		v[k] = int64(v32[k])
+	}
+	return v
+}
+
+// legacy 32-bit field of an id, 0 if out of range, since a truncated id
+// is another user
+func id32(v int64) int32 {
+	if v > math.MaxInt32 || v < math.MinInt32 {
+		return 0
+	}
+	return int32(v)
+}
+
+// legacy 32-bit field of a score, saturated at int32 bounds
+func score32(v int64) int32 {
+	if v > math.MaxInt32 {
+		return math.MaxInt32
+	} else if v < math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(v)
+}
+
+func ids32(v []int64) []int32 {
+	r := make([]int32, len(v))
+	for k := range v {
+		r[k] = id32(v[k])
+	}
+	return r
+}
+
+func scores32(v []int64) []int32 {
+	r := make([]int32, len(v))
+	for k := range v {
+		r[k] = score32(v[k])
+	}
+	return r
+}
+
+// score argument of a request, float sets take the float field, which
+// must not be NaN
+func score_arg(rs *RankSet, v64 int64, v32 int32, vf float64) (int64, error) {
+	if rs.Float {
+		if math.IsNaN(vf) || math.IsInf(vf, 0) {
+			return 0, ERROR_INVALID_ARGUMENT
+		}
+		return float_score(vf), nil
+	}
+	return pick64(v64, v32), nil
+}
+
+// score fields of a response, float sets fill the float field only
+func score_field(rs *RankSet, score int64) (int32, int64, float64) {
+	if rs.Float {
+		return 0, 0, score_float(score)
+	}
+	return score32(score), score, 0
+}
+
+func score_fields(rs *RankSet, scores []int64) (s32 []int32, s64 []int64, sf []float64) {
+	if rs.Float {
+		sf = make([]float64, len(scores))
+		for k := range scores {
+			sf[k] = score_float(scores[k])
+		}
+		return
+	}
+	return scores32(scores), scores, nil
+}
+
+func (s *server) CreateSet(ctx context.Context, p *Ranking_CreateSet) (*Ranking_Nil, error) {
+	if p.Order != Ranking_DESC && p.Order != Ranking_ASC || p.MaxSize < 0 || p.TTL < 0 || p.ExpireAt < 0 || p.IdleTTL < 0 {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+	if p.Period < Ranking_NONE || p.Period > Ranking_MONTHLY || p.Keep < 0 {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+	now := time.Now()
+	if p.ExpireAt > 0 && p.ExpireAt <= now.Unix() { // dead on arrival
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+
+	s.lock_write(func() {
+		if err = s.writable(); err != nil {
+			return
+		}
+		if s.live(p.SetId, now.Unix()) != nil {
+			err = ERROR_NAME_EXISTS
+			return
+		}
+		rs := NewRankSet()
+		rs.Float = p.Float
+		rs.Order = int(p.Order)
+		rs.Meta = SetMeta{
+			Name:      p.Name,
+			Owner:     p.Owner,
+			MaxSize:   p.MaxSize,
+			TTL:       p.TTL,
+			Labels:    p.Labels,
+			CreatedAt: now.Unix(),
+			Period:    int(p.Period),
+			Timezone:  p.Timezone,
+			Keep:      p.Keep,
+			Idle:      p.IdleTTL,
+		}
+		if rs.Meta.Period != PERIOD_NONE {
+			rs.Meta.Start = period_start(rs.Meta.Period, loc, now).Unix()
+		}
+		if p.ExpireAt > 0 {
+			rs.Meta.ExpireAt = p.ExpireAt
+		} else if p.TTL > 0 {
+			rs.Meta.ExpireAt = now.Unix() + p.TTL
+		}
+		s.ranks[p.SetId] = rs
+		s.replaced(p.SetId, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// persist the options even if no user joins
+	s.pending <- p.SetId
+	if err := s.wal.err(); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+func (s *server) DescribeSet(ctx context.Context, p *Ranking_SetId) (*Ranking_SetInfo, error) {
+	rs := s.get(p.SetId)
+
+	if rs == nil {
+		return nil, ERROR_NAME_NOT_EXISTS
+	}
+	return set_info(p.SetId, rs), nil
+}
+
+func (s *server) ListSets(ctx context.Context, p *Ranking_ListSets) (*Ranking_SetInfos, error) {
+	var ids []uint64
+	sets := make(map[uint64]*RankSet)
+	s.lock_read(func() {
+		for id, rs := range s.ranks {
+			ids = append(ids, id)
+			sets[id] = rs
+		}
+	})
+	now := time.Now().Unix()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	infos := &Ranking_SetInfos{}
+	for _, id := range ids {
+		if sets[id].Expired(now) {
+			continue
+		}
+		info := set_info(id, sets[id])
+		if p.Owner != "" && info.Owner != p.Owner {
+			continue
+		}
+		match := true
+		for k, v := range p.Labels {
+			if l, ok := info.Labels[k]; !ok || l != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			infos.Sets = append(infos.Sets, info)
+		}
+	}
+	return infos, nil
+}
+
+// description of a rankset
+func set_info(setid uint64, rs *RankSet) *Ranking_SetInfo {
+	rs.RLock()
+	defer rs.RUnlock()
+	return &Ranking_SetInfo{
+		SetId:       setid,
+		Order:       Ranking_Order(rs.Order),
+		Float:       rs.Float,
+		Name:        rs.Meta.Name,
+		Owner:       rs.Meta.Owner,
+		MaxSize:     rs.Meta.MaxSize,
+		TTL:         rs.Meta.TTL,
+		Labels:      rs.Meta.Labels,
+		CreatedAt:   rs.Meta.CreatedAt,
+		Count:       int32(len(rs.M)),
+		Period:      Ranking_Period(rs.Meta.Period),
+		Timezone:    rs.Meta.Timezone,
+		Keep:        rs.Meta.Keep,
+		PeriodStart: rs.Meta.Start,
+		ExpireAt:    rs.Meta.ExpireAt,
+		IdleTTL:     rs.Meta.Idle,
+		Derived:     rs.Meta.Derived != nil,
 	}
-	return &Ranking_UserList{Ranks: ranks, Scores: scores}, nil
 }
 
 func (s *server) DeleteSet(ctx context.Context, p *Ranking_SetId) (*Ranking_Nil, error) {
+	var err error
 	s.lock_write(func() {
+		if err = s.writable(); err != nil {
+			return
+		}
+		old := s.ranks[p.SetId]
 		delete(s.ranks, p.SetId)
+		delete(s.history, p.SetId)
+		s.replaced(p.SetId, old)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.pending <- p.SetId
+	if err := s.wal.err(); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+func (s *server) SetExpiry(ctx context.Context, p *Ranking_SetExpiry) (*Ranking_Nil, error) {
+	if p.ExpireAt < 0 {
+		return nil, ERROR_INVALID_ARGUMENT
+	}
+
+	err := s.update(p.SetId, func(rs *RankSet) {
+		rs.SetExpiry(p.ExpireAt)
+		s.wal.meta(p.SetId, rs)
 	})
+	if err != nil {
+		return nil, err
+	}
+	s.pending <- p.SetId
 	return OK, nil
 }
 
 func (s *server) DeleteUser(ctx context.Context, p *Ranking_DeleteUserRequest) (*Ranking_Nil, error) {
-	var rs *RankSet
-	s.lock_read(func() {
-		rs = s.ranks[p.SetId]
+	err := s.update(p.SetId, func(rs *RankSet) {
+		rs.Delete(pick64(p.UserId64, p.UserId))
 	})
-	if rs == nil {
-		return nil, ERROR_NAME_NOT_EXISTS
+	if err != nil {
+		return nil, err
 	}
-	rs.Delete(p.UserId)
+	s.pending <- p.SetId
 	return OK, nil
 }
 
+func (s *server) Snapshot(p *Ranking_SnapshotRequest, stream RankingService_SnapshotServer) error {
+	var setids []uint64
+	if len(p.SetIds) > 0 {
+		setids = append(setids, p.SetIds...)
+	}
+	records, err := s.snapshot(setids)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(&chunk_writer{stream: stream}, SNAPSHOT_CHUNK)
+	if err := write_snapshot(w, records); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (s *server) Restore(stream RankingService_RestoreServer) error {
+	snap, err := read_snapshot(&chunk_reader{stream: stream})
+	if err != nil {
+		return err
+	}
+	ids, err := s.load_snapshot(snap)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.pending <- id
+	}
+	if err := s.wal.err(); err != nil {
+		return err
+	}
+	log.Infof("restored %v ranksets from a snapshot taken at %v", len(ids), snap.created)
+	return stream.SendAndClose(&Ranking_Count{Count: int32(len(ids))})
+}
+
+// purge expired sets and inactive users from memory, db follows on dump
+func (s *server) sweep(now time.Time, changes map[uint64]bool) {
+	idle := make(map[uint64]*RankSet)
+	s.lock_write(func() {
+		for id, rs := range s.ranks {
+			if rs.Expired(now.Unix()) {
+				delete(s.ranks, id)
+				delete(s.history, id)
+				s.replaced(id, rs)
+				changes[id] = true
+				log.Infof("rankset %v expired", id)
+			} else if rs.Meta.Idle > 0 {
+				idle[id] = rs
+			}
+		}
+	})
+
+	// inactive users are deleted in batches, so writers get the lock between
+	for id, rs := range idle {
+		total := 0
+		for n := SWEEP_BATCH; n == SWEEP_BATCH; total += n {
+			n = 0
+			s.lock_read(func() {
+				if s.ranks[id] == rs { // not rotated or replaced meanwhile
+					n = rs.DeleteInactive(now.Unix()-rs.Meta.Idle, SWEEP_BATCH)
+				}
+			})
+		}
+		if total > 0 {
+			changes[id] = true
+			log.Infof("rankset %v removed %v inactive users", id, total)
+		}
+	}
+}
+
 // persistence ranking tree into db
 func (s *server) persistence_task() {
 	timer := time.After(CHECK_INTERVAL)
-	db := s.open_db()
 	changes := make(map[uint64]bool)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
 
 	for {
 		select {
 		case key := <-s.pending:
 			changes[key] = true
 		case <-timer:
-			s.dump(db, changes)
-			if len(changes) > 0 {
-				log.Infof("perisisted %v rankset:", len(changes))
+			s.sweep(time.Now(), changes)
+			s.rotate(time.Now())
+			if err := s.checkpoint(changes); err != nil {
+				log.Error(err)
+			} else {
+				if len(changes) > 0 {
+					log.Infof("perisisted %v rankset:", len(changes))
+				}
+				changes = make(map[uint64]bool)
 			}
-			changes = make(map[uint64]bool)
 			timer = time.After(CHECK_INTERVAL)
-		case nr := <-sig:
-			s.dump(db, changes)
-			db.Close()
-			log.Info(nr)
-			os.Exit(0)
+		case <-s.die:
+			s.done <- s.final(changes)
+			return
 		}
 	}
 }
 
-func (s *server) open_db() *bolt.DB {
-	db, err := bolt.Open(BOLTDB_FILE, 0600, nil)
-	if err != nil {
-		log.Panic(err)
-		os.Exit(-1)
-	}
-	// create bulket
-	db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET))
-		if err != nil {
-			log.Panicf("create bucket: %s", err)
-			os.Exit(-1)
+// start shutting down, open streams end so a graceful stop isn't held up
+// by them, and changes are refused from now on.
+func (s *server) end_streams() {
+	s.lock_write(func() { // changes in progress are done
+		select {
+		case <-s.quit:
+		default:
+			close(s.quit)
+		}
+	})
+}
+
+// stop the persistence task after a final checkpoint, rpcs cut off after
+// the drain timeout may still be running, but make no more changes.
+func (s *server) shutdown() error {
+	s.end_streams()
+
+	// derived sets are recomputed on startup
+	s.lock_write(func() {
+		for id, d := range s.derivers {
+			d.stop()
+			delete(s.derivers, id)
 		}
-		return nil
 	})
-	return db
+	close(s.die)
+	return <-s.done
+}
+
+// drain pending changes, checkpoint them and close the wal and storage
+func (s *server) final(changes map[uint64]bool) error {
+	for len(s.pending) > 0 {
+		changes[<-s.pending] = true
+	}
+	err := s.checkpoint(changes)
+	if err == nil {
+		log.Infof("perisisted %v rankset on shutdown", len(changes))
+	}
+	s.wal.close()
+	if e := s.store.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// dump changed sets along with the sets in the finished wal segment, the
+// segment is removed if the dump succeeded.
+func (s *server) checkpoint(changes map[uint64]bool) error {
+	seq, dirty := s.wal.cut()
+	for k := range dirty {
+		changes[k] = true
+	}
+	if err := s.dump(changes); err != nil {
+		return err
+	}
+	s.wal.truncate(seq)
+	return nil
 }
 
-func (s *server) dump(db *bolt.DB, changes map[uint64]bool) {
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BOLTDB_BUCKET))
+func (s *server) dump(changes map[uint64]bool) error {
+	// past generations of rotated sets are rewritten
+	var archived map[uint64]bool
+	s.lock_write(func() {
+		archived, s.archived = s.archived, make(map[uint64]bool)
+	})
+	for k := range archived {
+		changes[k] = true
+	}
+
+	taken := make(map[*RankSet][]int64) // dirty users in this dump
+	dumped := make(map[uint64]*RankSet)
+	err := s.store.Update(func(tx StorageTx) error {
 		for k := range changes {
-			// marshal
 			var rs *RankSet
+			var past []*RankSet
 			s.lock_read(func() {
 				rs = s.ranks[k]
+				past = s.history[k]
 			})
 
+			// past generations in storage follow the memory, they're
+			// gone if the set was deleted or recreated
+			if len(past) == 0 || archived[k] {
+				if err := tx.ClearHistory(k); err != nil {
+					return err
+				}
+			}
+			if archived[k] {
+				for _, h := range past {
+					if err := tx.SaveHistory(k, h); err != nil {
+						return err
+					}
+				}
+			}
+
+			dumped[k] = rs
 			if rs == nil { // rankset deletion
-				b.Delete([]byte(fmt.Sprint(k)))
-			} else { // serialization and save
-				bin, err := rs.Marshal()
-				if err != nil {
-					log.Error(err)
-					continue
+				if err := tx.DeleteSet(k); err != nil {
+					return err
 				}
-				b.Put([]byte(fmt.Sprint(k)), bin)
+				continue
+			}
+
+			// only changed users are saved, unless the set is replaced
+			ids := rs.TakeDirty()
+			taken[rs] = ids
+			if s.dumped[k] != rs {
+				ids = nil
+			}
+			if err := tx.SaveSet(k, rs, ids); err != nil {
+				return err
 			}
 		}
 		return nil
 	})
-}
 
-func (s *server) restore() {
-	// restore data from db file
-	db := s.open_db()
-	defer db.Close()
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BOLTDB_BUCKET))
-		b.ForEach(func(k, v []byte) error {
-			rs := NewRankSet()
-			err := rs.Unmarshal(v)
-			if err != nil {
-				log.Panic("rank data corrupted:", err)
-				os.Exit(-1)
-			}
-			id, err := strconv.ParseUint(string(k), 0, 64)
-			if err != nil {
-				log.Panic("rank data corrupted:", err)
-				os.Exit(-1)
+	if err != nil {
+		for rs, ids := range taken {
+			rs.MarkDirty(ids)
+		}
+		s.lock_write(func() {
+			for k := range archived {
+				s.archived[k] = true
 			}
-			s.ranks[id] = rs
-			return nil
 		})
+		return err
+	}
+	for k, rs := range dumped {
+		if rs == nil {
+			delete(s.dumped, k)
+		} else {
+			s.dumped[k] = rs
+		}
+	}
+	return nil
+}
+
+// restore data from the storage and the wal on top, returns the sequence
+// of the last wal segment.
+func (s *server) restore(prefix string) int {
+	err := s.store.Load(func(id uint64, rs *RankSet) error {
+		s.ranks[id] = rs
+		s.dumped[id] = rs
 		return nil
 	})
+	if err != nil {
+		log.Panic("rank data corrupted:", err)
+		os.Exit(-1)
+	}
+
+	// past generations of periodic sets
+	err = s.store.LoadHistory(func(id uint64, rs *RankSet) error {
+		s.history[id] = append(s.history[id], rs)
+		return nil
+	})
+	if err != nil {
+		log.Panic("rank history corrupted:", err)
+		os.Exit(-1)
+	}
+	for _, past := range s.history {
+		sort.Slice(past, func(i, j int) bool { return past[i].Meta.Start > past[j].Meta.Start })
+	}
+
+	// changes after the last dump, checkpointed at once
+	changes, last := s.replay(prefix)
+	if len(changes) > 0 {
+		if err := s.dump(changes); err != nil {
+			log.Panic("wal checkpoint:", err)
+			os.Exit(-1)
+		}
+	}
+	remove_wal(prefix, last)
+	return last
 }
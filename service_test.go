@@ -16,7 +16,7 @@ func TestRankChange(t *testing.T) {
 	// Set up a connection to the server.
 	conn, err := grpc.Dial(address)
 	if err != nil {
-		t.Fatal("did not connect: %v", err)
+		t.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
 	c := pb.NewRankingServiceClient(conn)
@@ -24,12 +24,12 @@ func TestRankChange(t *testing.T) {
 	COUNT := 5000
 	// Contact the server and print out its response.
 	for i := 1; i < COUNT; i++ {
-		_, err = c.RankChange(context.Background(), &pb.Ranking_Change{int32(i), int32(i), KEY})
+		_, err = c.RankChange(context.Background(), &pb.Ranking_Change{UserId: int32(i), Score: int32(i), SetId: KEY})
 		if err != nil {
 			t.Fatalf("could not query: %v", err)
 		}
 		if i%1000 == 0 {
-			list, err := c.QueryRankRange(context.Background(), &pb.Ranking_Range{1, 100, KEY})
+			list, err := c.QueryRankRange(context.Background(), &pb.Ranking_Range{A: 1, B: 100, SetId: KEY})
 			if err != nil {
 				t.Fatalf("could not query: %v", err)
 			}
@@ -37,3 +37,77 @@ func TestRankChange(t *testing.T) {
 		}
 	}
 }
+
+func TestStreamRankChanges(t *testing.T) {
+	conn, err := grpc.Dial(address)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := pb.NewRankingServiceClient(conn)
+
+	stream, err := c.StreamRankChanges(context.Background())
+	if err != nil {
+		t.Fatalf("could not open stream: %v", err)
+	}
+
+	COUNT := 5000
+	for i := 1; i <= COUNT; i++ {
+		err := stream.Send(&pb.Ranking_Change{UserId: int32(i), Score: int32(i), SetId: KEY, Seq: uint64(i)})
+		if err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+	stream.CloseSend()
+
+	// read acks until the final one
+	for {
+		ack, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("could not receive ack: %v", err)
+		}
+		t.Log(ack)
+		if ack.Seq == uint64(COUNT) {
+			break
+		}
+	}
+}
+
+func TestCreateSet(t *testing.T) {
+	conn, err := grpc.Dial(address)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := pb.NewRankingServiceClient(conn)
+
+	const SETID = 1001
+	c.DeleteSet(context.Background(), &pb.Ranking_SetId{SetId: SETID})
+	_, err = c.CreateSet(context.Background(), &pb.Ranking_CreateSet{
+		SetId:  SETID,
+		Order:  pb.Ranking_ASC,
+		Name:   "speedrun",
+		Owner:  "test",
+		Labels: map[string]string{"mode": "any%"},
+	})
+	if err != nil {
+		t.Fatalf("could not create: %v", err)
+	}
+	if _, err := c.CreateSet(context.Background(), &pb.Ranking_CreateSet{SetId: SETID + 1, ExpireAt: 1}); err == nil {
+		t.Fatal("set expired on creation should be rejected")
+	}
+
+	info, err := c.DescribeSet(context.Background(), &pb.Ranking_SetId{SetId: SETID})
+	if err != nil {
+		t.Fatalf("could not describe: %v", err)
+	}
+	if info.Name != "speedrun" || info.Order != pb.Ranking_ASC || info.CreatedAt == 0 {
+		t.Fatalf("set info mismatch: %v", info)
+	}
+
+	list, err := c.ListSets(context.Background(), &pb.Ranking_ListSets{Labels: map[string]string{"mode": "any%"}})
+	if err != nil {
+		t.Fatalf("could not list: %v", err)
+	}
+	t.Log(list)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+import (
+	. "rank/proto"
+)
+
+// a snapshot is a header of magic(8) version(4) sets(4) generations(4)
+// created(8) crc32(4), followed by records of kind(1) setid(8) length(4)
+// crc32(4) rankset. a crc32 covers all the fields before it in the header,
+// and all the other fields in a record.
+const (
+	SNAPSHOT_MAGIC   = "RANKSNAP"
+	SNAPSHOT_VERSION = 1
+	SNAPSHOT_CHUNK   = 64 * 1024 // size of a streamed chunk
+)
+
+// record kinds of a snapshot
+const (
+	SNAPSHOT_SET        = iota // a set
+	SNAPSHOT_GENERATION        // a past generation of a periodic set
+)
+
+var (
+	ERROR_SNAPSHOT_CORRUPTED = errors.New("snapshot corrupted")
+	ERROR_SNAPSHOT_VERSION   = errors.New("snapshot version not supported")
+)
+
+type snapshot_record struct {
+	kind  byte
+	setid uint64
+	dump  *rankset_dump // a copy of a set
+	past  *RankSet      // a past generation, never changes
+}
+
+func (r *snapshot_record) marshal() ([]byte, error) {
+	if r.dump != nil {
+		return msgpack.Marshal(r.dump)
+	}
+	return r.past.Marshal()
+}
+
+// the contents of a snapshot
+type snapshot struct {
+	created time.Time
+	sets    map[uint64]*RankSet
+	history map[uint64][]*RankSet // newest first
+}
+
+// take a point-in-time consistent snapshot of live sets with their past
+// generations, nil setids for all sets. all the sets are read locked
+// together only while copying, records are marshalled on writing.
+func (s *server) snapshot(setids []uint64) (records []snapshot_record, err error) {
+	s.lock_read(func() {
+		now := time.Now().Unix()
+		if setids == nil {
+			for id, rs := range s.ranks {
+				if !rs.Expired(now) {
+					setids = append(setids, id)
+				}
+			}
+		}
+		sort.Slice(setids, func(i, j int) bool { return setids[i] < setids[j] })
+		ids := setids[:0:0] // deduplicated, a set is read locked only once
+		for k, id := range setids {
+			if k == 0 || setids[k-1] != id {
+				ids = append(ids, id)
+			}
+		}
+
+		var locked []*RankSet
+		defer func() {
+			for _, rs := range locked {
+				rs.RUnlock()
+			}
+		}()
+		for _, id := range ids {
+			rs := s.ranks[id]
+			if rs == nil || rs.Expired(now) {
+				err = ERROR_NAME_NOT_EXISTS
+				return
+			}
+			rs.RLock()
+			locked = append(locked, rs)
+		}
+
+		for k, rs := range locked {
+			records = append(records, snapshot_record{kind: SNAPSHOT_SET, setid: ids[k], dump: rs.copy_dump()})
+		}
+		for _, id := range ids {
+			for _, h := range s.history[id] {
+				records = append(records, snapshot_record{kind: SNAPSHOT_GENERATION, setid: id, past: h})
+			}
+		}
+	})
+	return
+}
+
+func write_snapshot(w io.Writer, records []snapshot_record) error {
+	sets, generations := 0, 0
+	for _, r := range records {
+		if r.kind == SNAPSHOT_SET {
+			sets++
+		} else {
+			generations++
+		}
+	}
+
+	header := make([]byte, 32)
+	copy(header, SNAPSHOT_MAGIC)
+	binary.BigEndian.PutUint32(header[8:], SNAPSHOT_VERSION)
+	binary.BigEndian.PutUint32(header[12:], uint32(sets))
+	binary.BigEndian.PutUint32(header[16:], uint32(generations))
+	binary.BigEndian.PutUint64(header[20:], uint64(time.Now().Unix()))
+	binary.BigEndian.PutUint32(header[28:], crc32.ChecksumIEEE(header[:28]))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	// marshalled record by record
+	head := make([]byte, 17)
+	for k := range records {
+		r := &records[k]
+		bin, err := r.marshal()
+		if err != nil {
+			return err
+		}
+		head[0] = r.kind
+		binary.BigEndian.PutUint64(head[1:], r.setid)
+		binary.BigEndian.PutUint32(head[9:], uint32(len(bin)))
+		binary.BigEndian.PutUint32(head[13:], crc32.Update(crc32.ChecksumIEEE(head[:13]), crc32.IEEETable, bin))
+		if _, err := w.Write(head); err != nil {
+			return err
+		}
+		if _, err := w.Write(bin); err != nil {
+			return err
+		}
+		r.dump = nil // released once written
+	}
+	return nil
+}
+
+// read a whole snapshot, nothing is returned unless all checksums match
+func read_snapshot(r io.Reader) (*snapshot, error) {
+	header := make([]byte, 32)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ERROR_SNAPSHOT_CORRUPTED
+	}
+	if string(header[:8]) != SNAPSHOT_MAGIC || crc32.ChecksumIEEE(header[:28]) != binary.BigEndian.Uint32(header[28:]) {
+		return nil, ERROR_SNAPSHOT_CORRUPTED
+	}
+	if binary.BigEndian.Uint32(header[8:]) != SNAPSHOT_VERSION {
+		return nil, ERROR_SNAPSHOT_VERSION
+	}
+	count := int(binary.BigEndian.Uint32(header[12:])) + int(binary.BigEndian.Uint32(header[16:]))
+
+	snap := &snapshot{
+		created: time.Unix(int64(binary.BigEndian.Uint64(header[20:])), 0),
+		sets:    make(map[uint64]*RankSet),
+		history: make(map[uint64][]*RankSet),
+	}
+	head := make([]byte, 17)
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, ERROR_SNAPSHOT_CORRUPTED
+		}
+		size := binary.BigEndian.Uint32(head[9:])
+		if size > WAL_MAX_RECORD {
+			return nil, ERROR_SNAPSHOT_CORRUPTED
+		}
+		bin := make([]byte, size)
+		if _, err := io.ReadFull(r, bin); err != nil {
+			return nil, ERROR_SNAPSHOT_CORRUPTED
+		}
+		if crc32.Update(crc32.ChecksumIEEE(head[:13]), crc32.IEEETable, bin) != binary.BigEndian.Uint32(head[13:]) {
+			return nil, ERROR_SNAPSHOT_CORRUPTED
+		}
+
+		rs := NewRankSet()
+		if err := rs.Unmarshal(bin); err != nil {
+			return nil, err
+		}
+		setid := binary.BigEndian.Uint64(head[1:])
+		switch head[0] {
+		case SNAPSHOT_SET:
+			snap.sets[setid] = rs
+		case SNAPSHOT_GENERATION:
+			snap.history[setid] = append(snap.history[setid], rs)
+		default:
+			return nil, ERROR_SNAPSHOT_CORRUPTED
+		}
+	}
+
+	if len(snap.sets) != int(binary.BigEndian.Uint32(header[12:])) {
+		return nil, ERROR_SNAPSHOT_CORRUPTED
+	}
+	for id, past := range snap.history {
+		if snap.sets[id] == nil {
+			return nil, ERROR_SNAPSHOT_CORRUPTED
+		}
+		sort.Slice(past, func(i, j int) bool { return past[i].Meta.Start > past[j].Meta.Start })
+	}
+	return snap, nil
+}
+
+// replace sets with the ones in a snapshot, past generations are replaced
+// and saved too. returns the ids of the sets.
+func (s *server) load_snapshot(snap *snapshot) (ids []uint64, err error) {
+	s.lock_write(func() {
+		if err = s.writable(); err != nil {
+			return
+		}
+		for id, rs := range snap.sets {
+			old := s.ranks[id]
+			s.ranks[id] = rs
+			s.history[id] = snap.history[id]
+			s.replaced(id, old)
+			ids = append(ids, id)
+		}
+		// derivations start after all sets are in place
+		for id, rs := range snap.sets {
+			if rs.Meta.Derived != nil {
+				s.start_deriver(id, rs.Meta.Derived).mark_full()
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// past generations are only saved on rotation
+	e := s.store.Update(func(tx StorageTx) error {
+		for id := range snap.sets {
+			if err := tx.ClearHistory(id); err != nil {
+				return err
+			}
+			for _, h := range snap.history[id] {
+				if err := tx.SaveHistory(id, h); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if e != nil {
+		log.Error(e)
+	}
+	return ids, nil
+}
+
+// restore from a snapshot file at startup
+func (s *server) restore_snapshot(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Panic(err)
+		os.Exit(-1)
+	}
+	defer f.Close()
+	snap, err := read_snapshot(bufio.NewReader(f))
+	if err != nil {
+		log.Panic("snapshot:", err)
+		os.Exit(-1)
+	}
+
+	ids, err := s.load_snapshot(snap)
+	if err != nil {
+		log.Panic("snapshot:", err)
+		os.Exit(-1)
+	}
+	changes := make(map[uint64]bool)
+	for _, id := range ids {
+		changes[id] = true
+	}
+	if err := s.dump(changes); err != nil {
+		log.Panic("snapshot:", err)
+		os.Exit(-1)
+	}
+	log.Infof("restored %v ranksets from snapshot %v taken at %v", len(changes), path, snap.created)
+}
+
+// stream writer of a snapshot
+type chunk_writer struct {
+	stream RankingService_SnapshotServer
+}
+
+func (w *chunk_writer) Write(p []byte) (int, error) {
+	data := make([]byte, len(p)) // the chunk may be held by the stream
+	copy(data, p)
+	if err := w.stream.Send(&Ranking_Chunk{Data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stream reader of a snapshot
+type chunk_reader struct {
+	stream RankingService_RestoreServer
+	buf    []byte
+}
+
+func (r *chunk_reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := new_test_server()
+	for id := uint64(1); id <= 3; id++ {
+		rs := NewRankSet()
+		for i := int64(1); i <= 100; i++ {
+			rs.Update(i, i*int64(id), 0, UPDATE_ALWAYS)
+		}
+		s.ranks[id] = rs
+	}
+	h1, h2 := NewRankSet(), NewRankSet()
+	h1.Meta.Start, h2.Meta.Start = 100, 200
+	h2.Update(1, 2, 0, UPDATE_ALWAYS)
+	s.history[2] = []*RankSet{h2, h1}
+
+	if _, err := s.snapshot([]uint64{1, 4}); err != ERROR_NAME_NOT_EXISTS {
+		t.Fatal("missing set should fail", err)
+	}
+	records, err := s.snapshot([]uint64{2, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ranks[1].Update(101, 1, 0, UPDATE_ALWAYS) // taken after the snapshot
+	var buf bytes.Buffer
+	if err := write_snapshot(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	bin := buf.Bytes()
+
+	snap, err := read_snapshot(bytes.NewReader(bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.sets) != 2 || len(snap.history[2]) != 2 || snap.history[2][0].Meta.Start != 200 {
+		t.Fatal("snapshot mismatch", len(snap.sets), len(snap.history[2]))
+	}
+
+	// every byte is covered by a checksum
+	for _, off := range []int{0, 10, 30, 40, len(bin) - 1} {
+		bad := append([]byte(nil), bin...)
+		bad[off] ^= 0xff
+		if _, err := read_snapshot(bytes.NewReader(bad)); err == nil {
+			t.Fatal("corruption at", off, "should be detected")
+		}
+	}
+	if _, err := read_snapshot(bytes.NewReader(bin[:len(bin)-1])); err != ERROR_SNAPSHOT_CORRUPTED {
+		t.Fatal("truncation should be detected", err)
+	}
+
+	// restored over other sets, the rest are left alone
+	s2 := new_test_server()
+	other := NewRankSet()
+	other.Update(1, 1, 0, UPDATE_ALWAYS)
+	s2.ranks[1], s2.ranks[3] = other, other
+	ids, err := s2.load_snapshot(snap)
+	if err != nil || len(ids) != 2 || s2.ranks[3] != other {
+		t.Fatal("restored sets mismatch", ids)
+	}
+	s.ranks[1].Delete(101)
+	for _, id := range []uint64{1, 2} {
+		if !reflect.DeepEqual(s2.ranks[id].M, s.ranks[id].M) {
+			t.Fatal("restored set mismatch", id)
+		}
+	}
+	if len(s2.history[2]) != 2 || len(s2.store.(*memory_storage).history[2]) != 2 {
+		t.Fatal("restored history mismatch", len(s2.history[2]))
+	}
+}
+
+func TestSnapshotDuplicates(t *testing.T) {
+	s := new_test_server()
+	s.ranks[1], s.ranks[2] = NewRankSet(), NewRankSet()
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// a writer queued between two read locks of the same set would block
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := int64(0); ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				s.ranks[2].Update(i%100, i, 0, UPDATE_ALWAYS)
+			}
+		}
+	}()
+
+	done := make(chan error)
+	go func() {
+		for start := time.Now(); time.Since(start) < time.Second; {
+			records, err := s.snapshot([]uint64{2, 1, 2, 2})
+			if err != nil {
+				done <- err
+				return
+			}
+			if len(records) != 2 || records[0].setid != 1 || records[1].setid != 2 {
+				done <- fmt.Errorf("records mismatch %v", len(records))
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("snapshot with duplicate ids deadlocked")
+	}
+}
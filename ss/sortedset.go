@@ -1,8 +1,22 @@
 package ss
 
+import "sort"
+
+// elements are ordered by score descending, then tie ascending, then id ascending
 type sortpair struct {
-	id    int32
-	score int32
+	id    int64
+	score int64
+	tie   int64
+}
+
+func (a *sortpair) before(b *sortpair) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if a.tie != b.tie {
+		return a.tie < b.tie
+	}
+	return a.id < b.id
 }
 
 type SortedSet struct {
@@ -13,31 +27,29 @@ func (ss *SortedSet) Clear() {
 	ss.set = nil
 }
 
-func (ss *SortedSet) Insert(id, score int32) {
-	p := sortpair{id: id, score: score}
+// insert point of p
+func (ss *SortedSet) search(p *sortpair) int {
+	return sort.Search(len(ss.set), func(i int) bool { return p.before(&ss.set[i]) })
+}
+
+func (ss *SortedSet) Insert(id, score, tie int64) {
+	p := sortpair{id: id, score: score, tie: tie}
 	if len(ss.set) == 0 {
 		ss.set = []sortpair{p}
 		return
 	}
 
 	// grow
+	update_idx := ss.search(&p)
 	ss.set = append(ss.set, p)
-	update_idx := -1
-	for k := range ss.set {
-		if score > ss.set[k].score {
-			update_idx = k
-			break
-		}
-	}
-
-	if update_idx == -1 { // already appended
+	if update_idx == len(ss.set)-1 { // already appended
 		return
 	}
 
 	ss.rshift(update_idx, len(ss.set)-1, p)
 }
 
-func (ss *SortedSet) Delete(id int32) {
+func (ss *SortedSet) Delete(id int64) {
 	for k := range ss.set {
 		if ss.set[k].id == id {
 			ss.set = append(ss.set[:k], ss.set[k+1:]...)
@@ -46,7 +58,7 @@ func (ss *SortedSet) Delete(id int32) {
 	}
 }
 
-func (ss *SortedSet) Locate(id int32) int32 {
+func (ss *SortedSet) Locate(id int64) int32 {
 	for k := range ss.set {
 		if ss.set[k].id == id {
 			return int32(k + 1)
@@ -55,19 +67,12 @@ func (ss *SortedSet) Locate(id int32) int32 {
 	return -1
 }
 
-func (ss *SortedSet) Update(id, score int32) {
-	p := sortpair{id: id, score: score}
+func (ss *SortedSet) Update(id, score, tie int64) {
+	p := sortpair{id: id, score: score, tie: tie}
 	idx := -1
-	update_idx := -1
 	for k := range ss.set {
-		if idx == -1 && ss.set[k].id == id {
+		if ss.set[k].id == id {
 			idx = k
-		}
-		if update_idx == -1 && score > ss.set[k].score {
-			update_idx = k // insert point
-		}
-
-		if idx != -1 && update_idx != -1 { // both set, break
 			break
 		}
 	}
@@ -75,15 +80,12 @@ func (ss *SortedSet) Update(id, score int32) {
 		return
 	}
 
-	n := len(ss.set) - 1
-	// smallest
-	if update_idx == -1 {
-		update_idx = n
-	}
+	// insert point, counting the element itself
+	update_idx := ss.search(&p)
 
 	// shift
 	if update_idx > idx {
-		ss.lshift(idx, update_idx, p)
+		ss.lshift(idx, update_idx-1, p)
 	} else if update_idx < idx {
 		ss.rshift(update_idx, idx, p)
 	} else {
@@ -103,11 +105,45 @@ func (ss *SortedSet) rshift(i, j int, p sortpair) {
 	ss.set[i] = p
 }
 
-func (ss *SortedSet) GetList(a, b int) (ids []int32, scores []int32) {
-	ids, scores = make([]int32, b-a+1), make([]int32, b-a+1)
+// ranks of the group of elements tying with id in score & tie: the rank of
+// the first one, the dense rank counted in distinct (score, tie), and the
+// size of the group, -1 if not exists.
+func (ss *SortedSet) GroupRank(id int64) (first, dense, count int) {
+	idx := int(ss.Locate(id)) - 1
+	if idx < 0 {
+		return -1, -1, -1
+	}
+
+	same := func(i int) bool { return ss.set[i].score == ss.set[idx].score && ss.set[i].tie == ss.set[idx].tie }
+	first, last := idx, idx
+	for first > 0 && same(first-1) {
+		first--
+	}
+	for last < len(ss.set)-1 && same(last+1) {
+		last++
+	}
+
+	dense = 1
+	for i := 1; i <= first; i++ {
+		if ss.set[i].score != ss.set[i-1].score || ss.set[i].tie != ss.set[i-1].tie {
+			dense++
+		}
+	}
+	return first + 1, dense, last - first + 1
+}
+
+func (ss *SortedSet) GetList(a, b int) (ids []int64, scores []int64) {
+	ids, scores = make([]int64, b-a+1), make([]int64, b-a+1)
 	for k := a - 1; k <= b-1; k++ {
 		ids[k-a+1] = ss.set[k].id
 		scores[k-a+1] = ss.set[k].score
 	}
 	return
 }
+
+// rank range [A,B] of elements with score in [min,max], A > B if empty
+func (ss *SortedSet) ScoreRange(min, max int64) (A, B int) {
+	A = sort.Search(len(ss.set), func(i int) bool { return ss.set[i].score <= max }) + 1
+	B = sort.Search(len(ss.set), func(i int) bool { return ss.set[i].score < min })
+	return
+}
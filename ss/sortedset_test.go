@@ -7,17 +7,17 @@ import (
 func TestSS(t *testing.T) {
 	const COUNT = 10
 	ss := SortedSet{}
-	for i := int32(0); i < COUNT; i++ {
-		ss.Insert(i, i)
+	for i := int64(0); i < COUNT; i++ {
+		ss.Insert(i, i, 0)
 	}
 	t.Log(ss)
 
 	t.Log(ss.GetList(1, 10))
-	ss.Update(5, 100)
+	ss.Update(5, 100, 0)
 	t.Log(ss)
-	ss.Update(0, 200)
+	ss.Update(0, 200, 0)
 	t.Log(ss)
-	ss.Update(5, 3)
+	ss.Update(5, 3, 0)
 	t.Log(ss)
 
 	ss.Delete(3)
@@ -31,11 +31,52 @@ func TestSS(t *testing.T) {
 
 func TestUpdate(t *testing.T) {
 	ss := SortedSet{}
-	ss.Insert(1, 1)
-	ss.Update(1, 10)
+	ss.Insert(1, 1, 0)
+	ss.Update(1, 10, 0)
 	t.Log(ss.set)
-	ss.Insert(2, 2)
-	ss.Insert(3, 4)
-	ss.Update(1, 0)
+	ss.Insert(2, 2, 0)
+	ss.Insert(3, 4, 0)
+	ss.Update(1, 0, 0)
 	t.Log(ss.set)
+	if ss.Locate(3) != 1 || ss.Locate(2) != 2 || ss.Locate(1) != 3 {
+		t.Fatal("update order mismatch", ss.set)
+	}
+}
+
+func TestScoreRange(t *testing.T) {
+	ss := SortedSet{}
+	for i := int64(0); i < 100; i++ {
+		ss.Insert(i, i/2, 0)
+	}
+
+	A, B := ss.ScoreRange(10, 20)
+	t.Log(A, B)
+	if A != 59 || B != 80 {
+		t.Fatal("score range mismatch", A, B)
+	}
+}
+
+func TestGroupRank(t *testing.T) {
+	ss := SortedSet{}
+	for i := int64(0); i < 10; i++ {
+		ss.Insert(i, i/3, 0)
+	}
+	ss.Update(8, 3, 1) // same score as 9, worse tie
+	// 9 | 8 | 6 7 | 3 4 5 | 0 1 2
+
+	first, dense, count := ss.GroupRank(7)
+	if first != 3 || dense != 3 || count != 2 {
+		t.Fatal("group rank mismatch", first, dense, count)
+	}
+	first, dense, count = ss.GroupRank(8)
+	if first != 2 || dense != 2 || count != 1 {
+		t.Fatal("tie group mismatch", first, dense, count)
+	}
+	first, dense, count = ss.GroupRank(1)
+	if first != 8 || dense != 5 || count != 3 {
+		t.Fatal("last group mismatch", first, dense, count)
+	}
+	if first, _, _ = ss.GroupRank(100); first != -1 {
+		t.Fatal("missing id should be -1", first)
+	}
 }
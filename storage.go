@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// storage backends, selected at startup
+const (
+	STORAGE_BOLT   = "bolt"   // a boltdb file, users are stored incrementally
+	STORAGE_DIR    = "dir"    // a directory of snapshot files, a file per set
+	STORAGE_MEMORY = "memory" // nothing survives a restart, for tests
+)
+
+// a storage persists sets and past generations of periodic sets
+type Storage interface {
+	// iterate all stored sets
+	Load(f func(setid uint64, rs *RankSet) error) error
+	// iterate all past generations
+	LoadHistory(f func(setid uint64, rs *RankSet) error) error
+	// apply a batch of changes, atomically if the storage supports
+	Update(f func(tx StorageTx) error) error
+	Close() error
+}
+
+// changes within Storage.Update
+type StorageTx interface {
+	// save a set, only the users in ids unless ids is nil, storages may
+	// always save the whole set.
+	SaveSet(setid uint64, rs *RankSet, ids []int64) error
+	DeleteSet(setid uint64) error
+	// past generations are keyed by Meta.Start
+	SaveHistory(setid uint64, rs *RankSet) error
+	DeleteHistory(setid uint64, start int64) error
+	// delete all past generations of a set
+	ClearHistory(setid uint64) error
+}
+
+// open a storage by kind
+func open_storage(kind string) (Storage, error) {
+	switch kind {
+	case STORAGE_BOLT:
+		return open_bolt(BOLTDB_FILE)
+	case STORAGE_DIR:
+		return open_dir(SNAPSHOT_DIR)
+	case STORAGE_MEMORY:
+		return new_memory(), nil
+	}
+	return nil, fmt.Errorf("unknown storage: %v", kind)
+}
+
+// an in-memory storage, sets are kept serialized, so the round trip is the
+// same as other storages
+type memory_storage struct {
+	sets    map[uint64][]byte
+	history map[uint64]map[int64][]byte
+	sync.Mutex
+}
+
+func new_memory() *memory_storage {
+	m := new(memory_storage)
+	m.sets = make(map[uint64][]byte)
+	m.history = make(map[uint64]map[int64][]byte)
+	return m
+}
+
+func (m *memory_storage) Load(f func(setid uint64, rs *RankSet) error) error {
+	m.Lock()
+	defer m.Unlock()
+	for id, bin := range m.sets {
+		rs := NewRankSet()
+		if err := rs.Unmarshal(bin); err != nil {
+			return err
+		}
+		if err := f(id, rs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memory_storage) LoadHistory(f func(setid uint64, rs *RankSet) error) error {
+	m.Lock()
+	defer m.Unlock()
+	for id, past := range m.history {
+		for _, bin := range past {
+			rs := NewRankSet()
+			if err := rs.Unmarshal(bin); err != nil {
+				return err
+			}
+			if err := f(id, rs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memory_storage) Update(f func(tx StorageTx) error) error {
+	m.Lock()
+	defer m.Unlock()
+	return f(m)
+}
+
+func (m *memory_storage) Close() error {
+	return nil
+}
+
+func (m *memory_storage) SaveSet(setid uint64, rs *RankSet, ids []int64) error {
+	bin, err := rs.Marshal()
+	if err != nil {
+		return err
+	}
+	m.sets[setid] = bin
+	return nil
+}
+
+func (m *memory_storage) DeleteSet(setid uint64) error {
+	delete(m.sets, setid)
+	return nil
+}
+
+func (m *memory_storage) SaveHistory(setid uint64, rs *RankSet) error {
+	bin, err := rs.Marshal()
+	if err != nil {
+		return err
+	}
+	if m.history[setid] == nil {
+		m.history[setid] = make(map[int64][]byte)
+	}
+	m.history[setid][rs.Meta.Start] = bin
+	return nil
+}
+
+func (m *memory_storage) DeleteHistory(setid uint64, start int64) error {
+	delete(m.history[setid], start)
+	if len(m.history[setid]) == 0 {
+		delete(m.history, setid)
+	}
+	return nil
+}
+
+func (m *memory_storage) ClearHistory(setid uint64) error {
+	delete(m.history, setid)
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+// sets are stored in a bucket per set, with users keyed by id, so only
+// changed users are written.
+type bolt_storage struct {
+	db *bolt.DB
+}
+
+type bolt_tx struct {
+	tx *bolt.Tx
+}
+
+// open a boltdb file, whole sets of former versions are migrated
+func open_bolt(path string) (*bolt_storage, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	// create bulket
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{BOLTDB_SETS_BUCKET, BOLTDB_HISTORY_BUCKET} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b := &bolt_storage{db: db}
+	if err := b.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// move whole sets of former versions into set buckets
+func (b *bolt_storage) migrate() error {
+	count := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		legacy := tx.Bucket([]byte(BOLTDB_BUCKET))
+		if legacy == nil {
+			return nil
+		}
+		err := legacy.ForEach(func(k, v []byte) error {
+			id, err := strconv.ParseUint(string(k), 0, 64)
+			if err != nil {
+				return err
+			}
+			rs := NewRankSet()
+			if err := rs.Unmarshal(v); err != nil {
+				return err
+			}
+			count++
+			return (&bolt_tx{tx}).SaveSet(id, rs, nil)
+		})
+		if err != nil {
+			return err
+		}
+		return tx.DeleteBucket([]byte(BOLTDB_BUCKET))
+	})
+	if count > 0 {
+		log.Infof("migrated %v ranksets into %v", count, BOLTDB_SETS_BUCKET)
+	}
+	return err
+}
+
+func (b *bolt_storage) Load(f func(setid uint64, rs *RankSet) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		sets := tx.Bucket([]byte(BOLTDB_SETS_BUCKET))
+		return sets.ForEach(func(k, v []byte) error {
+			id, err := strconv.ParseUint(string(k), 0, 64)
+			if err != nil {
+				return err
+			}
+			sb := sets.Bucket(k)
+			if sb == nil {
+				return fmt.Errorf("invalid set %v", id)
+			}
+			rs := NewRankSet()
+			users := sb.Bucket([]byte(BOLTDB_SET_USERS))
+			err = rs.UnmarshalEntries(sb.Get([]byte(BOLTDB_SET_INFO)), func(f func(id int64, bin []byte) error) error {
+				if users == nil {
+					return nil
+				}
+				return users.ForEach(func(k, v []byte) error {
+					if len(k) != 8 {
+						return fmt.Errorf("invalid user key %x", k)
+					}
+					return f(int64(binary.BigEndian.Uint64(k)), v)
+				})
+			})
+			if err != nil {
+				return err
+			}
+			return f(id, rs)
+		})
+	})
+}
+
+func (b *bolt_storage) LoadHistory(f func(setid uint64, rs *RankSet) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BOLTDB_HISTORY_BUCKET)).ForEach(func(k, v []byte) error {
+			var id uint64
+			var start int64
+			if _, err := fmt.Sscanf(string(k), "%d/%d", &id, &start); err != nil {
+				return err
+			}
+			rs := NewRankSet()
+			if err := rs.Unmarshal(v); err != nil {
+				return err
+			}
+			return f(id, rs)
+		})
+	})
+}
+
+func (b *bolt_storage) Update(f func(tx StorageTx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return f(&bolt_tx{tx})
+	})
+}
+
+func (b *bolt_storage) Close() error {
+	return b.db.Close()
+}
+
+// db key of a user in a set
+func user_key(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (t *bolt_tx) SaveSet(setid uint64, rs *RankSet, ids []int64) error {
+	sets := t.tx.Bucket([]byte(BOLTDB_SETS_BUCKET))
+	key := []byte(fmt.Sprint(setid))
+	if ids == nil && sets.Bucket(key) != nil { // rewritten as a whole
+		if err := sets.DeleteBucket(key); err != nil {
+			return err
+		}
+	}
+
+	info, err := rs.MarshalInfo()
+	if err != nil {
+		return err
+	}
+	b, err := sets.CreateBucketIfNotExists(key)
+	if err != nil {
+		return err
+	}
+	if err := b.Put([]byte(BOLTDB_SET_INFO), info); err != nil {
+		return err
+	}
+	users, err := b.CreateBucketIfNotExists([]byte(BOLTDB_SET_USERS))
+	if err != nil {
+		return err
+	}
+	return rs.Entries(ids, func(id int64, bin []byte) error {
+		if bin == nil {
+			return users.Delete(user_key(id))
+		}
+		return users.Put(user_key(id), bin)
+	})
+}
+
+func (t *bolt_tx) DeleteSet(setid uint64) error {
+	sets := t.tx.Bucket([]byte(BOLTDB_SETS_BUCKET))
+	key := []byte(fmt.Sprint(setid))
+	if sets.Bucket(key) == nil {
+		return nil
+	}
+	return sets.DeleteBucket(key)
+}
+
+func (t *bolt_tx) SaveHistory(setid uint64, rs *RankSet) error {
+	bin, err := rs.Marshal()
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket([]byte(BOLTDB_HISTORY_BUCKET)).Put(history_key(setid, rs.Meta.Start), bin)
+}
+
+func (t *bolt_tx) DeleteHistory(setid uint64, start int64) error {
+	return t.tx.Bucket([]byte(BOLTDB_HISTORY_BUCKET)).Delete(history_key(setid, start))
+}
+
+func (t *bolt_tx) ClearHistory(setid uint64) error {
+	c := t.tx.Bucket([]byte(BOLTDB_HISTORY_BUCKET)).Cursor()
+	prefix := []byte(fmt.Sprintf("%v/", setid))
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// a directory of snapshot files, sets are saved as a whole into
+// "setid.set", and past generations into "setid.start.hist". files are
+// replaced atomically, a batch is not.
+type dir_storage struct {
+	dir string
+}
+
+func open_dir(dir string) (*dir_storage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &dir_storage{dir: dir}, nil
+}
+
+func (d *dir_storage) set_file(setid uint64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%v.set", setid))
+}
+
+func (d *dir_storage) history_file(setid uint64, start int64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%v.%v.hist", setid, start))
+}
+
+// read all files with the suffix, fields are the dot separated parts of
+// the name before the suffix.
+func (d *dir_storage) each(suffix string, f func(fields []string, rs *RankSet) error) error {
+	names, err := filepath.Glob(filepath.Join(d.dir, "*"+suffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		bin, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rs := NewRankSet()
+		if err := rs.Unmarshal(bin); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		if err := f(strings.Split(strings.TrimSuffix(filepath.Base(name), suffix), "."), rs); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (d *dir_storage) Load(f func(setid uint64, rs *RankSet) error) error {
+	return d.each(".set", func(fields []string, rs *RankSet) error {
+		id, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil || len(fields) != 1 {
+			return fmt.Errorf("invalid set file")
+		}
+		return f(id, rs)
+	})
+}
+
+func (d *dir_storage) LoadHistory(f func(setid uint64, rs *RankSet) error) error {
+	return d.each(".hist", func(fields []string, rs *RankSet) error {
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid history file")
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		return f(id, rs)
+	})
+}
+
+func (d *dir_storage) Update(f func(tx StorageTx) error) error {
+	return f(d)
+}
+
+func (d *dir_storage) Close() error {
+	return nil
+}
+
+// write a file atomically by renaming a synced temporary file
+func (d *dir_storage) write(name string, rs *RankSet) error {
+	bin, err := rs.Marshal()
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bin); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (d *dir_storage) remove(name string) error {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *dir_storage) SaveSet(setid uint64, rs *RankSet, ids []int64) error {
+	return d.write(d.set_file(setid), rs)
+}
+
+func (d *dir_storage) DeleteSet(setid uint64) error {
+	return d.remove(d.set_file(setid))
+}
+
+func (d *dir_storage) SaveHistory(setid uint64, rs *RankSet) error {
+	return d.write(d.history_file(setid, rs.Meta.Start), rs)
+}
+
+func (d *dir_storage) DeleteHistory(setid uint64, start int64) error {
+	return d.remove(d.history_file(setid, start))
+}
+
+func (d *dir_storage) ClearHistory(setid uint64) error {
+	names, err := filepath.Glob(filepath.Join(d.dir, fmt.Sprintf("%v.*.hist", setid)))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := d.remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	. "rank/proto"
+)
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	opens := map[string]func() (Storage, error){
+		STORAGE_MEMORY: func() (Storage, error) { return new_memory(), nil },
+		STORAGE_DIR:    func() (Storage, error) { return open_dir(filepath.Join(dir, "snapshots")) },
+		STORAGE_BOLT:   func() (Storage, error) { return open_bolt(filepath.Join(dir, "rank.db")) },
+	}
+	for kind, open := range opens {
+		store, err := open()
+		if err != nil {
+			t.Fatal(kind, err)
+		}
+
+		rs1, rs2 := NewRankSet(), NewRankSet()
+		for i := int64(1); i <= 2000; i++ {
+			rs1.Update(i, i%10, i%3, UPDATE_ALWAYS)
+		}
+		rs1.SetGroup([]int64{1, 5000}, 7)
+		rs2.Update(1, 1, 0, UPDATE_ALWAYS)
+		h1, h2 := NewRankSet(), NewRankSet()
+		h1.Meta.Start, h2.Meta.Start = 100, 200
+		h2.Update(1, 2, 0, UPDATE_ALWAYS)
+		rs1.TakeDirty()
+		err = store.Update(func(tx StorageTx) error {
+			for _, err := range []error{tx.SaveSet(1, rs1, nil), tx.SaveSet(2, rs2, nil), tx.SaveHistory(1, h1), tx.SaveHistory(1, h2)} {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(kind, err)
+		}
+
+		// changed users only
+		rs1.Update(2, 100, 0, UPDATE_ALWAYS)
+		rs1.Delete(3)
+		err = store.Update(func(tx StorageTx) error {
+			for _, err := range []error{tx.SaveSet(1, rs1, rs1.TakeDirty()), tx.DeleteSet(2), tx.DeleteHistory(1, 100)} {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(kind, err)
+		}
+
+		if kind != STORAGE_MEMORY {
+			store.Close()
+			if store, err = open(); err != nil {
+				t.Fatal(kind, err)
+			}
+		}
+		sets := make(map[uint64]*RankSet)
+		store.Load(func(id uint64, rs *RankSet) error {
+			sets[id] = rs
+			return nil
+		})
+		if len(sets) != 1 || sets[1] == nil {
+			t.Fatal(kind, "sets mismatch", len(sets))
+		}
+		if !reflect.DeepEqual(sets[1].M, rs1.M) || !reflect.DeepEqual(sets[1].T, rs1.T) || !reflect.DeepEqual(sets[1].G, rs1.G) {
+			t.Fatal(kind, "loaded set mismatch", len(sets[1].M), sets[1].G)
+		}
+		if ids, _ := sets[1].GetList(1, 10); !reflect.DeepEqual(ids, func() []int64 { ids, _ := rs1.GetList(1, 10); return ids }()) {
+			t.Fatal(kind, "loaded ranks mismatch", ids)
+		}
+
+		var past []*RankSet
+		store.LoadHistory(func(id uint64, rs *RankSet) error {
+			past = append(past, rs)
+			return nil
+		})
+		if len(past) != 1 || past[0].Meta.Start != 200 || past[0].Count() != 1 {
+			t.Fatal(kind, "history mismatch", len(past))
+		}
+
+		store.Update(func(tx StorageTx) error { return tx.ClearHistory(1) })
+		past = nil
+		store.LoadHistory(func(id uint64, rs *RankSet) error {
+			past = append(past, rs)
+			return nil
+		})
+		if len(past) != 0 {
+			t.Fatal(kind, "history should be cleared", len(past))
+		}
+		store.Close()
+	}
+}
+
+// raw entry of a user in db, nil if not exists
+func db_entry(db *bolt.DB, setid uint64, id int64) (e *rank_entry) {
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_SETS_BUCKET)).Bucket([]byte(fmt.Sprint(setid)))
+		if b == nil {
+			return nil
+		}
+		if v := b.Bucket([]byte(BOLTDB_SET_USERS)).Get(user_key(id)); v != nil {
+			e = new(rank_entry)
+			msgpack.Unmarshal(v, e)
+		}
+		return nil
+	})
+	return
+}
+
+func TestIncrementalDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rank.db")
+	prefix := filepath.Join(t.TempDir(), "wal")
+
+	// a whole set of former versions
+	old := NewRankSet()
+	for i := int64(1); i <= 2000; i++ {
+		old.Update(i, i, 0, UPDATE_ALWAYS)
+	}
+	old.SetGroup([]int64{1, 3000}, 7)
+	bin, _ := old.Marshal()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET))
+		return b.Put([]byte("1"), bin)
+	})
+	db.Close()
+
+	// migrated on open
+	store, err := open_bolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	db = store.db
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(BOLTDB_BUCKET)) != nil {
+			t.Fatal("former bucket should be removed")
+		}
+		return nil
+	})
+	if e := db_entry(db, 1, 2000); e == nil || e.Score != 2000 || !e.Scored {
+		t.Fatal("migrated entry mismatch", e)
+	}
+	if e := db_entry(db, 1, 3000); e == nil || e.Scored || e.Group != 7 {
+		t.Fatal("group only entry mismatch", e)
+	}
+
+	s := new_test_server()
+	s.store = store
+	s.restore(prefix)
+
+	// an entry altered behind, only changed users are written over it
+	db.Update(func(tx *bolt.Tx) error {
+		bin, _ := msgpack.Marshal(&rank_entry{Score: 999, Scored: true})
+		return tx.Bucket([]byte(BOLTDB_SETS_BUCKET)).Bucket([]byte("1")).Bucket([]byte(BOLTDB_SET_USERS)).Put(user_key(5), bin)
+	})
+	rs := s.ranks[1]
+	rs.Update(10, -10, 3, UPDATE_ALWAYS)
+	rs.Delete(20)
+	if err := s.dump(map[uint64]bool{1: true}); err != nil {
+		t.Fatal(err)
+	}
+	if e := db_entry(db, 1, 5); e == nil || e.Score != 999 {
+		t.Fatal("unchanged entry should not be written", e)
+	}
+	if e := db_entry(db, 1, 10); e == nil || e.Score != -10 || e.Tie != 3 {
+		t.Fatal("changed entry mismatch", e)
+	}
+	if e := db_entry(db, 1, 20); e != nil {
+		t.Fatal("deleted entry should be removed", e)
+	}
+
+	// a recreated set is rewritten as a whole
+	rs2 := NewRankSet()
+	rs2.Update(1, 1, 0, UPDATE_ALWAYS)
+	s.ranks[1] = rs2
+	if err := s.dump(map[uint64]bool{1: true}); err != nil {
+		t.Fatal(err)
+	}
+	if e := db_entry(db, 1, 5); e != nil {
+		t.Fatal("entry of the former set should be removed", e)
+	}
+
+	// restored from entries
+	s2 := new_test_server()
+	s2.store = store
+	s2.restore(prefix)
+	if s2.ranks[1].Count() != 1 || s2.dumped[1] != s2.ranks[1] {
+		t.Fatal("restored set mismatch", s2.ranks[1].Count())
+	}
+
+	// deleted
+	delete(s.ranks, 1)
+	s.dump(map[uint64]bool{1: true})
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(BOLTDB_SETS_BUCKET)).Bucket([]byte("1")) != nil {
+			t.Fatal("deleted set should be removed")
+		}
+		return nil
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "wal")
+	s := new_test_server()
+	s.wal, _ = open_wal(prefix, WAL_SYNC_NEVER, 1)
+	store := s.store.(*memory_storage)
+	go s.persistence_task()
+
+	// changes still pending are saved by the final checkpoint
+	for id := uint64(1); id <= 3; id++ {
+		s.lock_write(func() {
+			s.ranks[id] = NewRankSet()
+			s.replaced(id, nil)
+		})
+		s.ranks[id].Update(1, int64(id), 0, UPDATE_ALWAYS)
+		s.pending <- id
+	}
+	if err := s.shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.sets) != 3 {
+		t.Fatal("pending sets should be saved", len(store.sets))
+	}
+	if segs := wal_segments(prefix); len(segs) != 1 || segs[0] != 2 {
+		t.Fatal("checkpointed segment should be removed", segs)
+	}
+
+	// rpcs cut off by the drain timeout change nothing
+	ctx := context.Background()
+	if _, err := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, Score64: 1}); err != ERROR_SHUTTING_DOWN {
+		t.Fatal("changes should be refused", err)
+	}
+	if _, err := s.RankChangeBatch(ctx, &Ranking_ChangeBatch{Changes: []*Ranking_Change{{SetId: 4, UserId64: 1}}}); err != ERROR_SHUTTING_DOWN || s.ranks[4] != nil {
+		t.Fatal("batches should be refused", err)
+	}
+}
+
+// streams without a connection
+type change_stream struct {
+	changes chan *Ranking_Change
+	acks    []*Ranking_Ack
+	grpc.ServerStream
+}
+
+func (c *change_stream) Context() context.Context { return context.Background() }
+
+func (c *change_stream) Send(ack *Ranking_Ack) error {
+	copied := *ack
+	c.acks = append(c.acks, &copied)
+	return nil
+}
+
+func (c *change_stream) Recv() (*Ranking_Change, error) {
+	if p, ok := <-c.changes; ok {
+		return p, nil
+	}
+	return nil, io.EOF
+}
+
+type top_stream struct {
+	sent chan *Ranking_RankList
+	grpc.ServerStream
+}
+
+func (c *top_stream) Context() context.Context { return context.Background() }
+
+func (c *top_stream) Send(l *Ranking_RankList) error {
+	c.sent <- l
+	return nil
+}
+
+func TestEndStreams(t *testing.T) {
+	s := new_test_server()
+	changes := &change_stream{changes: make(chan *Ranking_Change)}
+	defer close(changes.changes)
+	top := &top_stream{sent: make(chan *Ranking_RankList, 1)}
+	s.RankChange(context.Background(), &Ranking_Change{SetId: 1, UserId64: 1, Score64: 1})
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.StreamRankChanges(changes) }()
+	go func() { errs <- s.WatchTop(&Ranking_WatchTop{SetId: 1, Top: 10}, top) }()
+	for seq := uint64(1); seq <= 3; seq++ {
+		changes.changes <- &Ranking_Change{SetId: 1, UserId64: int64(seq) + 1, Score64: 10, Seq: seq}
+	}
+	<-top.sent
+	for k := 0; k < 100 && s.ranks[1].Count() != 4; k++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// open streams end with a final ack of the last applied change
+	s.end_streams()
+	for k := 0; k < 2; k++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("streams should end")
+		}
+	}
+	if n := len(changes.acks); n == 0 || changes.acks[n-1].Seq != 3 || changes.acks[n-1].Applied != 3 {
+		t.Fatal("final ack mismatch", changes.acks)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// the write-ahead log keeps the changes between dumps. it's split into
+// segments, a new segment is cut before each dump, and the older ones are
+// removed once the dump succeeded.
+// records are absolute states rather than operations, so replaying changes
+// already in the dump does no harm.
+
+// wal record types
+const (
+	WAL_USER       = iota // state of a user: score, tie and group
+	WAL_SET               // a set created or replaced, with its dump
+	WAL_META              // meta of a set changed
+	WAL_DELETE_SET        // a set deleted
+	WAL_ROTATE            // a periodic set rotated, with the dump of the next generation
+)
+
+const (
+	WAL_MAX_RECORD = 1 << 30 // a larger length means the record is corrupted
+)
+
+// fsync policies of the wal, positive durations are fsync intervals
+const (
+	WAL_SYNC_ALWAYS = time.Duration(0)
+	WAL_SYNC_NEVER  = time.Duration(-1)
+)
+
+var (
+	ERROR_WAL_CORRUPTED = errors.New("wal record corrupted")
+	ERROR_WAL_FAILED    = errors.New("wal write failed, writes are refused until a checkpoint")
+)
+
+type wal_record struct {
+	Op    int      `msgpack:"op"`
+	SetId uint64   `msgpack:"set"`
+	Id    int64    `msgpack:"id,omitempty"`
+	Has   bool     `msgpack:"has,omitempty"` // the user has a score
+	Score int64    `msgpack:"score,omitempty"`
+	Tie   int64    `msgpack:"tie,omitempty"`
+	Group int64    `msgpack:"group,omitempty"`
+	U     int64    `msgpack:"u,omitempty"` // last activity of the user
+	Dump  []byte   `msgpack:"dump,omitempty"`
+	Meta  *SetMeta `msgpack:"meta,omitempty"`
+}
+
+type wal struct {
+	prefix  string        // segments are named prefix.seq
+	fsync   time.Duration // WAL_SYNC_XXX or an interval
+	f       *os.File
+	seq     int                  // sequence of the current segment
+	dirty   map[uint64]bool      // sets changed in the current segment
+	sets    map[uint64]*RankSet  // observed sets, guarded by the server lock
+	handles map[uint64]*Observer // guarded by the server lock
+	failed  error                // a failed write or sync, cleared once its segment is dumped
+	failseq int                  // the segment of the last failure
+	die     chan struct{}
+	sync.Mutex
+}
+
+// parse a fsync policy: always, never, or an interval in milliseconds
+func parse_fsync(v string) (time.Duration, error) {
+	switch v {
+	case "always":
+		return WAL_SYNC_ALWAYS, nil
+	case "never":
+		return WAL_SYNC_NEVER, nil
+	}
+	ms, err := strconv.Atoi(v)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("invalid fsync policy: %v", v)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func wal_name(prefix string, seq int) string {
+	return fmt.Sprintf("%v.%06d", prefix, seq)
+}
+
+// sequences of the existing segments, ascending
+func wal_segments(prefix string) []int {
+	names, _ := filepath.Glob(prefix + ".*")
+	var seqs []int
+	for _, name := range names {
+		if seq, err := strconv.Atoi(strings.TrimPrefix(name, prefix+".")); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Ints(seqs)
+	return seqs
+}
+
+// open the wal for appending from segment seq
+func open_wal(prefix string, fsync time.Duration, seq int) (*wal, error) {
+	f, err := os.OpenFile(wal_name(prefix, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(wal)
+	w.prefix = prefix
+	w.fsync = fsync
+	w.f = f
+	w.seq = seq
+	w.dirty = make(map[uint64]bool)
+	w.sets = make(map[uint64]*RankSet)
+	w.handles = make(map[uint64]*Observer)
+	w.die = make(chan struct{})
+	if fsync > 0 {
+		go w.sync_task()
+	}
+	return w, nil
+}
+
+// append a record, every record is written through, so it survives a crash
+// of the process, and synced to disk by the fsync policy. a failure marks
+// the wal failed, the set is still dumped on the next checkpoint.
+// record: length(4) crc32(4) msgpack
+func (w *wal) append(r *wal_record) {
+	if w == nil {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.dirty[r.SetId] = true
+
+	bin, err := msgpack.Marshal(r)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	buf := make([]byte, 8+len(bin))
+	binary.BigEndian.PutUint32(buf, uint32(len(bin)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(bin))
+	copy(buf[8:], bin)
+
+	if _, err := w.f.Write(buf); err != nil {
+		w.fail(err)
+		return
+	}
+	if w.fsync == WAL_SYNC_ALWAYS {
+		if err := w.f.Sync(); err != nil {
+			w.fail(err)
+		}
+	}
+}
+
+// called with wal lock held
+func (w *wal) fail(err error) {
+	log.Error("wal:", err)
+	w.failed = err
+	w.failseq = w.seq
+}
+
+// ERROR_WAL_FAILED if a record may have been lost since the last
+// checkpoint, writes are refused meanwhile.
+func (w *wal) err() error {
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.failed != nil {
+		return ERROR_WAL_FAILED
+	}
+	return nil
+}
+
+func (w *wal) sync_task() {
+	ticker := time.NewTicker(w.fsync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.Lock()
+			if err := w.f.Sync(); err != nil {
+				w.fail(err)
+			}
+			w.Unlock()
+		case <-w.die:
+			return
+		}
+	}
+}
+
+// log every change of a set, nil to stop logging,
+// called with server write lock held.
+func (w *wal) observe(setid uint64, rs *RankSet) {
+	if w == nil {
+		return
+	}
+	if old := w.sets[setid]; old != nil {
+		old.Unobserve(w.handles[setid])
+		delete(w.sets, setid)
+		delete(w.handles, setid)
+	}
+	if rs != nil {
+		w.sets[setid] = rs
+		w.handles[setid] = rs.Observe(func(id int64) { // the set is locked while observing
+			score, has := rs.M[id]
+			w.append(&wal_record{Op: WAL_USER, SetId: setid, Id: id, Has: has, Score: score, Tie: rs.T[id], Group: rs.G[id], U: rs.U[id]})
+		})
+	}
+}
+
+// log a replaced or removed set, called with server write lock held.
+func (w *wal) replaced(setid uint64, rs *RankSet) {
+	if w == nil {
+		return
+	}
+	if rs == nil {
+		w.append(&wal_record{Op: WAL_DELETE_SET, SetId: setid})
+	} else if bin, err := rs.Marshal(); err != nil {
+		log.Error(err)
+	} else {
+		w.append(&wal_record{Op: WAL_SET, SetId: setid, Dump: bin})
+	}
+	w.observe(setid, rs)
+}
+
+// log a rotated set, called with server write lock held.
+func (w *wal) rotated(setid uint64, next *RankSet) {
+	if w == nil {
+		return
+	}
+	if bin, err := next.Marshal(); err != nil {
+		log.Error(err)
+	} else {
+		w.append(&wal_record{Op: WAL_ROTATE, SetId: setid, Dump: bin})
+	}
+	w.observe(setid, next)
+}
+
+// log the meta of a set
+func (w *wal) meta(setid uint64, rs *RankSet) {
+	if w == nil {
+		return
+	}
+	rs.RLock()
+	meta := rs.Meta
+	rs.RUnlock()
+	w.append(&wal_record{Op: WAL_META, SetId: setid, Meta: &meta})
+}
+
+// start a new segment, returns the sequence of the last finished segment
+// and the sets changed in it. on failure the current segment is kept,
+// nothing is finished.
+func (w *wal) cut() (seq int, dirty map[uint64]bool) {
+	if w == nil {
+		return 0, nil
+	}
+	w.Lock()
+	defer w.Unlock()
+
+	f, err := os.OpenFile(wal_name(w.prefix, w.seq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Error(err)
+		dirty = make(map[uint64]bool)
+		for k := range w.dirty {
+			dirty[k] = true
+		}
+		return w.seq - 1, dirty
+	}
+	if err := w.f.Sync(); err != nil {
+		log.Error(err)
+	}
+	w.f.Close()
+
+	seq, dirty = w.seq, w.dirty
+	w.f = f
+	w.seq++
+	w.dirty = make(map[uint64]bool)
+	return
+}
+
+// remove segments up to seq, their changes have been dumped, so is a
+// failure in them.
+func (w *wal) truncate(seq int) {
+	if w == nil {
+		return
+	}
+	w.Lock()
+	if w.failed != nil && w.failseq <= seq {
+		w.failed = nil
+		log.Info("wal recovered by checkpoint")
+	}
+	w.Unlock()
+	remove_wal(w.prefix, seq)
+}
+
+func remove_wal(prefix string, seq int) {
+	for _, k := range wal_segments(prefix) {
+		if k > seq {
+			break
+		}
+		if err := os.Remove(wal_name(prefix, k)); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+func (w *wal) close() {
+	if w == nil {
+		return
+	}
+	close(w.die)
+	w.Lock()
+	defer w.Unlock()
+	w.f.Sync()
+	w.f.Close()
+}
+
+// read records of a segment in order, a torn or corrupted record stops
+// the reading with an error.
+func read_wal(name string, f func(r *wal_record)) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rd := bufio.NewReader(file)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(rd, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return ERROR_WAL_CORRUPTED
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > WAL_MAX_RECORD {
+			return ERROR_WAL_CORRUPTED
+		}
+		bin := make([]byte, size)
+		if _, err := io.ReadFull(rd, bin); err != nil {
+			return ERROR_WAL_CORRUPTED
+		}
+		if crc32.ChecksumIEEE(bin) != binary.BigEndian.Uint32(header[4:]) {
+			return ERROR_WAL_CORRUPTED
+		}
+		r := new(wal_record)
+		if err := msgpack.Unmarshal(bin, r); err != nil {
+			return ERROR_WAL_CORRUPTED
+		}
+		f(r)
+	}
+}
+
+// replay all segments on top of the restored sets, returns the changed
+// sets and the sequence of the last segment, 0 if none. records after a
+// corrupted one are dropped, they were never acknowledged if it's torn by
+// a crash.
+func (s *server) replay(prefix string) (changes map[uint64]bool, last int) {
+	changes = make(map[uint64]bool)
+	count := 0
+	broken := false
+	for _, seq := range wal_segments(prefix) {
+		last = seq
+		if broken {
+			continue
+		}
+		err := read_wal(wal_name(prefix, seq), func(r *wal_record) {
+			s.apply(r)
+			changes[r.SetId] = true
+			count++
+		})
+		if err != nil {
+			log.Errorf("wal segment %v: %v", seq, err)
+			broken = true
+		}
+	}
+	if count > 0 {
+		log.Infof("replayed %v wal records", count)
+	}
+	return
+}
+
+// apply a wal record
+func (s *server) apply(r *wal_record) {
+	switch r.Op {
+	case WAL_USER:
+		rs := s.ranks[r.SetId]
+		if rs == nil {
+			rs = NewRankSet()
+			s.ranks[r.SetId] = rs
+		}
+		rs.SetGroup([]int64{r.Id}, r.Group)
+		if r.Has {
+			rs.Update(r.Id, r.Score, r.Tie, UPDATE_ALWAYS)
+			rs.SetActivity(r.Id, r.U)
+		} else {
+			rs.Delete(r.Id)
+		}
+	case WAL_SET:
+		rs := NewRankSet()
+		if err := rs.Unmarshal(r.Dump); err != nil {
+			log.Error(err)
+			return
+		}
+		s.ranks[r.SetId] = rs
+	case WAL_META:
+		if rs := s.ranks[r.SetId]; rs != nil && r.Meta != nil {
+			rs.Lock()
+			rs.Meta = *r.Meta
+			rs.Unlock()
+		}
+	case WAL_DELETE_SET:
+		delete(s.ranks, r.SetId)
+		delete(s.history, r.SetId)
+	case WAL_ROTATE:
+		next := NewRankSet()
+		if err := next.Unmarshal(r.Dump); err != nil {
+			log.Error(err)
+			return
+		}
+		// the rotation may be in the dump already
+		if rs := s.ranks[r.SetId]; rs != nil && rs.Meta.Start < next.Meta.Start {
+			s.archive(r.SetId, rs, next)
+		}
+		s.ranks[r.SetId] = next
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	. "rank/proto"
+)
+
+func TestWal(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "wal")
+	s := new_test_server()
+	w, err := open_wal(prefix, WAL_SYNC_ALWAYS, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.wal = w
+
+	ctx := context.Background()
+	s.CreateSet(ctx, &Ranking_CreateSet{SetId: 1, Order: Ranking_ASC, MaxSize: 3})
+	for i := int64(1); i <= 5; i++ {
+		s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: i, Score64: 10 - i, Tie: i % 2})
+	}
+	s.RankChange(ctx, &Ranking_Change{SetId: 2, UserId64: 1, Score64: 1})
+	s.RankChange(ctx, &Ranking_Change{SetId: 3, UserId64: 1, ScoreFloat: 1.5, Float: true})
+	s.IncrementScore(ctx, &Ranking_Increment{SetId: 2, UserId64: 1, Delta64: 5})
+	s.DeleteUser(ctx, &Ranking_DeleteUserRequest{SetId: 1, UserId64: 4})
+	s.JoinGroup(ctx, &Ranking_Membership{SetId: 2, UserIds: []int64{1, 2}, GroupId: 7})
+	s.SetExpiry(ctx, &Ranking_SetExpiry{SetId: 2, ExpireAt: 1 << 40})
+	s.DeleteSet(ctx, &Ranking_SetId{SetId: 3})
+
+	// a dump in between, set 1 goes on in the next segment
+	seq, dirty := w.cut()
+	if seq != 1 || !dirty[1] || !dirty[2] || !dirty[3] {
+		t.Fatal("cut mismatch", seq, dirty)
+	}
+	s2 := new_test_server()
+	for id, rs := range s.ranks {
+		bin, _ := rs.Marshal()
+		s2.ranks[id] = NewRankSet()
+		s2.ranks[id].Unmarshal(bin)
+	}
+	w.truncate(seq)
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 6, Score64: 1})
+	w.close()
+
+	// a torn record at the tail is dropped
+	f, _ := os.OpenFile(wal_name(prefix, 2), os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	// replay onto the dump
+	changes, last := s2.replay(prefix)
+	if last != 2 || !changes[1] || changes[2] {
+		t.Fatal("replay mismatch", last, changes)
+	}
+	if len(s2.ranks) != 2 {
+		t.Fatal("sets mismatch", len(s2.ranks))
+	}
+	rs, rs2 := s.ranks[1], s2.ranks[1]
+	if !reflect.DeepEqual(rs.M, rs2.M) || !reflect.DeepEqual(rs.T, rs2.T) || rs2.Order != ORDER_ASC || rs2.Meta.MaxSize != 3 {
+		t.Fatal("replayed set mismatch", rs.M, rs2.M, rs2.Order, rs2.Meta)
+	}
+
+	remove_wal(prefix, last)
+	if segs := wal_segments(prefix); len(segs) != 0 {
+		t.Fatal("segments should be removed", segs)
+	}
+}
+
+func TestWalReplay(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "wal")
+	s := new_test_server()
+	s.wal, _ = open_wal(prefix, 10*time.Millisecond, 1) // synced in background
+
+	ctx := context.Background()
+	for i := int64(1); i <= 2000; i++ {
+		s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: i, Score64: i % 100, Tie: i % 3})
+	}
+	s.JoinGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{1, 2}, GroupId: 7})
+	s.LeaveGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{2}})
+	s.SetExpiry(ctx, &Ranking_SetExpiry{SetId: 1, ExpireAt: 1 << 40})
+	for i := int64(1); i <= 2000; i += 2 {
+		s.DeleteUser(ctx, &Ranking_DeleteUserRequest{SetId: 1, UserId64: i})
+	}
+	s.RankChange(ctx, &Ranking_Change{SetId: 2, UserId64: 1, Score64: 1})
+	s.DeleteSet(ctx, &Ranking_SetId{SetId: 2})
+	s.wal.close()
+
+	s2 := new_test_server()
+	s2.replay(prefix)
+	rs, rs2 := s.ranks[1], s2.ranks[1]
+	if !reflect.DeepEqual(rs.M, rs2.M) || !reflect.DeepEqual(rs.T, rs2.T) || !reflect.DeepEqual(rs.G, rs2.G) || rs2.Meta.ExpireAt != 1<<40 {
+		t.Fatal("replayed set mismatch", len(rs.M), len(rs2.M), rs2.G, rs2.Meta)
+	}
+	if s2.ranks[2] != nil {
+		t.Fatal("deleted set should be gone")
+	}
+	ids, _ := rs.GetList(1, 100)
+	ids2, _ := rs2.GetList(1, 100)
+	if !reflect.DeepEqual(ids, ids2) {
+		t.Fatal("replayed ranks mismatch", ids, ids2)
+	}
+}
+
+func TestWalFailed(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "wal")
+	s := new_test_server()
+	s.wal, _ = open_wal(prefix, WAL_SYNC_ALWAYS, 1)
+	ctx := context.Background()
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 1, Score64: 1})
+
+	// a change that can't be logged fails, so do the later ones
+	s.wal.f.Close()
+	if _, err := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, Score64: 2}); err != ERROR_WAL_FAILED {
+		t.Fatal("unlogged change should fail", err)
+	}
+	if _, err := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 3, Score64: 3}); err != ERROR_WAL_FAILED {
+		t.Fatal("changes should be refused", err)
+	}
+	if _, err := s.DeleteSet(ctx, &Ranking_SetId{SetId: 1}); err != ERROR_WAL_FAILED || s.ranks[1].Count() != 2 {
+		t.Fatal("changes should not be applied", err, s.ranks[1].Count())
+	}
+
+	// a checkpoint dumps the unlogged change and recovers
+	if err := s.checkpoint(make(map[uint64]bool)); err != nil {
+		t.Fatal(err)
+	}
+	count := int32(0)
+	s.store.Load(func(setid uint64, rs *RankSet) error {
+		count = rs.Count()
+		return nil
+	})
+	if count != 2 {
+		t.Fatal("unlogged change should be dumped", count)
+	}
+	if _, err := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 3, Score64: 3}); err != nil {
+		t.Fatal("wal should recover", err)
+	}
+	s.wal.close()
+}
+
+func TestWalActivity(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "wal")
+	s := new_test_server()
+	s.wal, _ = open_wal(prefix, WAL_SYNC_ALWAYS, 1)
+
+	ctx := context.Background()
+	s.CreateSet(ctx, &Ranking_CreateSet{SetId: 1, IdleTTL: 60})
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 1, Score64: 10})
+	s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 2, Score64: 10})
+	for len(s.pending) > 0 {
+		<-s.pending
+	}
+
+	// the activity goes with every record
+	rs := s.ranks[1]
+	before := time.Now().Unix() - 120
+	rs.U[1], rs.U[2] = before, before
+	s.JoinGroup(ctx, &Ranking_Membership{SetId: 1, UserIds: []int64{2}, GroupId: 7})
+
+	// a submission without a change is persisted
+	r, _ := s.RankChange(ctx, &Ranking_Change{SetId: 1, UserId64: 1, Score64: 5, Mode: Ranking_GREATER})
+	if r.Changed || len(s.pending) == 0 || rs.U[1] == before {
+		t.Fatal("submission should touch", r.Changed, len(s.pending), rs.U[1])
+	}
+	s.wal.close()
+
+	s2 := new_test_server()
+	s2.replay(prefix)
+	if rs2 := s2.ranks[1]; !reflect.DeepEqual(rs.U, rs2.U) {
+		t.Fatal("replayed activity mismatch", rs.U, rs2.U)
+	}
+}
+
+func TestParseFsync(t *testing.T) {
+	if d, err := parse_fsync("always"); err != nil || d != WAL_SYNC_ALWAYS {
+		t.Fatal("always mismatch", d, err)
+	}
+	if d, err := parse_fsync("never"); err != nil || d != WAL_SYNC_NEVER {
+		t.Fatal("never mismatch", d, err)
+	}
+	if d, err := parse_fsync("250"); err != nil || d.Seconds() != 0.25 {
+		t.Fatal("interval mismatch", d, err)
+	}
+	if _, err := parse_fsync("0"); err == nil {
+		t.Fatal("zero interval should fail")
+	}
+}